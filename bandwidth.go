@@ -0,0 +1,349 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ByteRate A bandwidth in bytes per second, 0 means unlimited.
+type ByteRate int64
+
+// byteUnits Multipliers of the units a ByteRate can be given in. Units are
+// binary, 1K is 1024 bytes.
+var byteUnits = map[string]float64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// ParseByteRate Parse a bandwidth like 500K, 1.5M or 10MiB/s. 0 and off mean
+// unlimited.
+func ParseByteRate(value string) (ByteRate, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "/s")
+
+	if s == "off" {
+		return 0, nil
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	if i < 0 {
+		i = len(s)
+	}
+
+	// K, KB and KiB are all the same.
+	unit := strings.TrimSpace(s[i:])
+	if len(unit) > 1 {
+		unit = strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i")
+	}
+
+	multiplier, ok := byteUnits[unit]
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid bandwidth '%s', use a number of bytes per second like 500K, 1.5M or off", value)
+	}
+
+	return ByteRate(n * multiplier), nil
+}
+
+// String Format the rate like 1.5 MiB/s.
+func (r ByteRate) String() string {
+	if r <= 0 {
+		return "off"
+	}
+
+	return formatBytes(int64(r)) + "/s"
+}
+
+// Set Parse the rate from a flag.
+func (r *ByteRate) Set(value string) error {
+	rate, err := ParseByteRate(value)
+	if err != nil {
+		return err
+	}
+
+	*r = rate
+	return nil
+}
+
+// UnmarshalYAML Parse the rate from the config file.
+func (r *ByteRate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	return r.Set(value)
+}
+
+// ScheduleEntry A bandwidth limit that applies from a time of day until the
+// next entry of the schedule.
+type ScheduleEntry struct {
+	// Minutes after midnight, local time.
+	Start int
+	Limit ByteRate
+}
+
+// String Format the entry like 08:00=1.0 MiB/s.
+func (e ScheduleEntry) String() string {
+	return fmt.Sprintf("%02d:%02d=%s", e.Start/60, e.Start%60, e.Limit)
+}
+
+// BandwidthSchedule Bandwidth limits by time of day, ordered by start. The
+// last entry carries on past midnight until the first one.
+type BandwidthSchedule []ScheduleEntry
+
+// ParseScheduleEntry Parse an entry like 08:00=1M.
+func ParseScheduleEntry(value string) (ScheduleEntry, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return ScheduleEntry{}, fmt.Errorf("Invalid schedule entry '%s', use HH:MM=<bandwidth>", value)
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+	if err != nil {
+		return ScheduleEntry{}, fmt.Errorf("Invalid time in schedule entry '%s', use HH:MM", value)
+	}
+
+	limit, err := ParseByteRate(parts[1])
+	if err != nil {
+		return ScheduleEntry{}, err
+	}
+
+	return ScheduleEntry{
+		Start: start.Hour()*60 + start.Minute(),
+		Limit: limit,
+	}, nil
+}
+
+// add Add an entry, keeping the schedule ordered.
+func (s *BandwidthSchedule) add(entry ScheduleEntry) error {
+	for _, e := range *s {
+		if e.Start == entry.Start {
+			return fmt.Errorf("Schedule has more than one entry for %02d:%02d", entry.Start/60, entry.Start%60)
+		}
+	}
+
+	*s = append(*s, entry)
+	sort.Slice(*s, func(i, k int) bool {
+		return (*s)[i].Start < (*s)[k].Start
+	})
+
+	return nil
+}
+
+// String Format the schedule as a comma-separated list of entries.
+func (s *BandwidthSchedule) String() string {
+	var entries []string
+	for _, e := range *s {
+		entries = append(entries, e.String())
+	}
+
+	return strings.Join(entries, ",")
+}
+
+// Set Add entries from a flag, given as a comma-separated list.
+func (s *BandwidthSchedule) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		entry, err := ParseScheduleEntry(item)
+		if err != nil {
+			return err
+		}
+
+		if err = s.add(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalYAML Parse the schedule from a list of entries in the config file.
+func (s *BandwidthSchedule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var entries []string
+	if err := unmarshal(&entries); err != nil {
+		return err
+	}
+
+	*s = nil
+	return s.Set(strings.Join(entries, ","))
+}
+
+// At Get the limit that applies at t, and if the schedule has any entries.
+func (s BandwidthSchedule) At(t time.Time) (ByteRate, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	limit := s[len(s)-1].Limit
+
+	for _, e := range s {
+		if e.Start > minutes {
+			break
+		}
+
+		limit = e.Limit
+	}
+
+	return limit, true
+}
+
+// BandwidthLimiter Limits the rate data is sent at with a token bucket. The
+// limit comes from an override set at runtime, the schedule or the default
+// limit, in that order.
+type BandwidthLimiter struct {
+	limit    ByteRate
+	schedule BandwidthSchedule
+	override *ByteRate
+
+	// Bytes that can be sent right away, negative when we are in debt for
+	// a block larger than what a second allows.
+	tokens float64
+	last   time.Time
+	mtx    sync.Mutex
+}
+
+// NewBandwidthLimiter Create new instance of BandwidthLimiter.
+func NewBandwidthLimiter(limit ByteRate, schedule BandwidthSchedule) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		limit:    limit,
+		schedule: schedule,
+		last:     time.Now(),
+	}
+}
+
+// Limit Get the limit that applies now.
+func (b *BandwidthLimiter) Limit() ByteRate {
+	if b == nil {
+		return 0
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.limitAt(time.Now())
+}
+
+// limitAt Get the limit that applies at t. Has to be called with mtx held.
+func (b *BandwidthLimiter) limitAt(t time.Time) ByteRate {
+	if b.override != nil {
+		return *b.override
+	}
+
+	if limit, ok := b.schedule.At(t); ok {
+		return limit
+	}
+
+	return b.limit
+}
+
+// Override Get the limit set at runtime, if any.
+func (b *BandwidthLimiter) Override() (ByteRate, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.override == nil {
+		return 0, false
+	}
+
+	return *b.override, true
+}
+
+// SetOverride Use limit instead of the schedule and default limit, until
+// ClearOverride is called.
+func (b *BandwidthLimiter) SetOverride(limit ByteRate) {
+	b.mtx.Lock()
+	b.override = &limit
+	b.mtx.Unlock()
+}
+
+// ClearOverride Go back to the schedule and default limit.
+func (b *BandwidthLimiter) ClearOverride() {
+	b.mtx.Lock()
+	b.override = nil
+	b.mtx.Unlock()
+}
+
+// SetLimits Change the default limit and schedule, an override set at
+// runtime stays in place.
+func (b *BandwidthLimiter) SetLimits(limit ByteRate, schedule BandwidthSchedule) {
+	b.mtx.Lock()
+	b.limit = limit
+	b.schedule = schedule
+	b.mtx.Unlock()
+}
+
+// refill Add the tokens earned since the last refill, at most a second
+// worth. Has to be called with mtx held.
+func (b *BandwidthLimiter) refill(now time.Time) ByteRate {
+	limit := b.limitAt(now)
+
+	if limit <= 0 {
+		// Unlimited, any debt is forgiven.
+		b.tokens = 0
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * float64(limit)
+		if b.tokens > float64(limit) {
+			b.tokens = float64(limit)
+		}
+	}
+
+	b.last = now
+	return limit
+}
+
+// Wait until n bytes may be sent, or ctx is done. Changes of the limit
+// apply within a second, also to a wait in progress. Does nothing if b is
+// nil.
+func (b *BandwidthLimiter) Wait(ctx context.Context, n int64) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mtx.Lock()
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	b.mtx.Unlock()
+
+	for {
+		b.mtx.Lock()
+		limit := b.refill(time.Now())
+		tokens := b.tokens
+		b.mtx.Unlock()
+
+		if limit <= 0 || tokens >= 0 {
+			return nil
+		}
+
+		wait := time.Duration(-tokens / float64(limit) * float64(time.Second))
+		if wait > time.Second {
+			wait = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
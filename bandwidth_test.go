@@ -0,0 +1,134 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ByteRate
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"off", 0, false},
+		{" OFF ", 0, false},
+		{"1000", 1000, false},
+		{"100B", 100, false},
+		{"500K", 500 << 10, false},
+		{"500k", 500 << 10, false},
+		{"500KB", 500 << 10, false},
+		{"500KiB", 500 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{"10MiB/s", 10 << 20, false},
+		{"2 M", 2 << 20, false},
+		{"1G", 1 << 30, false},
+		{"1T", 1 << 40, false},
+
+		{"", 0, true},
+		{"M", 0, true},
+		{"fast", 0, true},
+		{"-1", 0, true},
+		{"5X", 0, true},
+		{"1.2.3M", 0, true},
+		{"10 per second", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseByteRate(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteRate(%q) = %d, want an error", test.value, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseByteRate(%q) failed: %s", test.value, err)
+		} else if got != test.want {
+			t.Errorf("ParseByteRate(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+}
+
+func TestBandwidthScheduleAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		at       string
+		want     ByteRate
+	}{
+		{"single entry before its start", "08:00=1M", "07:00", 1 << 20},
+		{"single entry after its start", "08:00=1M", "09:00", 1 << 20},
+
+		{"at first start", "08:00=1M,18:00=off", "08:00", 1 << 20},
+		{"within first", "08:00=1M,18:00=off", "17:59", 1 << 20},
+		{"at second start", "08:00=1M,18:00=off", "18:00", 0},
+		{"before midnight", "08:00=1M,18:00=off", "23:59", 0},
+		{"after midnight", "08:00=1M,18:00=off", "00:00", 0},
+		{"before first start", "08:00=1M,18:00=off", "07:59", 0},
+
+		{"window wrapping midnight at start", "22:00=100K,06:00=off", "22:00", 100 << 10},
+		{"window wrapping midnight before midnight", "22:00=100K,06:00=off", "23:30", 100 << 10},
+		{"window wrapping midnight at midnight", "22:00=100K,06:00=off", "00:00", 100 << 10},
+		{"window wrapping midnight after midnight", "22:00=100K,06:00=off", "05:59", 100 << 10},
+		{"window wrapping midnight ended", "22:00=100K,06:00=off", "06:00", 0},
+		{"window wrapping midnight not started", "22:00=100K,06:00=off", "21:59", 0},
+
+		{"entry at midnight", "00:00=1M,12:00=2M", "00:00", 1 << 20},
+		{"entry at midnight late", "00:00=1M,12:00=2M", "23:59", 2 << 20},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var schedule BandwidthSchedule
+			if err := schedule.Set(test.schedule); err != nil {
+				t.Fatalf("Set(%q) failed: %s", test.schedule, err)
+			}
+
+			clock, err := time.Parse("15:04", test.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			at := time.Date(2021, 3, 1, clock.Hour(), clock.Minute(), 30, 0, time.Local)
+
+			got, ok := schedule.At(at)
+			if !ok {
+				t.Fatalf("At(%s) of %s has no entries", test.at, test.schedule)
+			}
+
+			if got != test.want {
+				t.Errorf("At(%s) of %s = %s, want %s", test.at, test.schedule, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBandwidthScheduleAtEmpty(t *testing.T) {
+	var schedule BandwidthSchedule
+	if limit, ok := schedule.At(time.Now()); ok {
+		t.Errorf("At of an empty schedule = %s, want no entries", limit)
+	}
+}
+
+func TestBandwidthScheduleSetOrders(t *testing.T) {
+	var schedule BandwidthSchedule
+	if err := schedule.Set("18:00=off, 08:00=1M"); err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+
+	if got, want := schedule.String(), "08:00=1.0 MiB/s,18:00=off"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if err := schedule.Set("08:00=2M"); err == nil {
+		t.Errorf("Set of a second entry for 08:00 didn't fail")
+	}
+}
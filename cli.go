@@ -0,0 +1,129 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix Prefix of the environment variables that flags fall back to.
+const envPrefix = "FILEWATCHER_"
+
+// command A subcommand of filewatcher.
+type command struct {
+	name        string
+	synopsis    string
+	usage       string
+	description string
+	run         func(cmd *command, args []string)
+}
+
+// listFlag A flag that can be given more than once, each value may also be
+// a comma-separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set Add values to the list.
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+
+	return nil
+}
+
+// envName Name of the environment variable for a flag, -poll-interval
+// becomes FILEWATCHER_POLL_INTERVAL.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// newFlagSet Create the flag set for a command, -h and --help print its usage.
+// All commands take the logging flags.
+func (cmd *command) newFlagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	flags.String("log-level", LevelInfo.String(), "Only log entries of this level and above: debug, info, warn or error")
+	flags.String("log-format", LogFormatText, "Log as text or json")
+
+	flags.Usage = func() {
+		out := flags.Output()
+
+		fmt.Fprintf(out, "Usage:\n\t%s %s %s\n\n", os.Args[0], cmd.name, cmd.usage)
+		fmt.Fprintf(out, "%s\n", cmd.description)
+
+		hasFlags := false
+		flags.VisitAll(func(f *flag.Flag) { hasFlags = true })
+
+		if hasFlags {
+			fmt.Fprintf(out, "\nFlags:\n")
+			flags.PrintDefaults()
+			fmt.Fprintf(out, "\nEvery flag can also be set with an environment variable, "+
+				"-poll-interval as %s and so on.\n", envName("poll-interval"))
+		}
+	}
+
+	return flags
+}
+
+// parseFlags Parse the command line, flags not given there are taken from
+// the environment. A flag given in both only gets the value of the command
+// line, so list flags don't end up with both.
+func (cmd *command) parseFlags(flags *flag.FlagSet, args []string) {
+	flags.Parse(args)
+
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || given[f.Name] {
+			return
+		}
+
+		if err := flags.Set(f.Name, value); err != nil {
+			cmd.usageError(flags, fmt.Sprintf("invalid value %q for %s: %s", value, envName(f.Name), err))
+		}
+	})
+
+	level, err := ParseLogLevel(flags.Lookup("log-level").Value.String())
+	if err != nil {
+		cmd.usageError(flags, err.Error())
+	}
+
+	logger.SetLevel(level)
+
+	err = logger.SetFormat(flags.Lookup("log-format").Value.String())
+	if err != nil {
+		cmd.usageError(flags, err.Error())
+	}
+}
+
+// usageError Print an error along with the usage of the command and exit.
+func (cmd *command) usageError(flags *flag.FlagSet, msg string) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	flags.SetOutput(os.Stderr)
+	flags.Usage()
+	os.Exit(2)
+}
+
+// printUsage Print the list of commands.
+func printUsage(commands []*command) {
+	fmt.Fprintf(os.Stderr, "Usage:\n\t%s <command> [flags] [arguments]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-10s%s\n", cmd.name, cmd.synopsis)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -help' for the flags of a command.\n", os.Args[0])
+}
@@ -0,0 +1,47 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFlagsEnvironment(t *testing.T) {
+	env := map[string]string{
+		"FILEWATCHER_EXCLUDE":       "from-env",
+		"FILEWATCHER_POLL_INTERVAL": "5s",
+	}
+
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	cmd := &command{name: "test"}
+
+	var exclude listFlag
+	var pollInterval time.Duration
+
+	flags := cmd.newFlagSet()
+	flags.Var(&exclude, "exclude", "")
+	flags.DurationVar(&pollInterval, "poll-interval", time.Second, "")
+	cmd.parseFlags(flags, []string{"-exclude", "a,b", "path"})
+
+	// The command line replaces the environment, lists are not merged.
+	if want := (listFlag{"a", "b"}); !reflect.DeepEqual(exclude, want) {
+		t.Errorf("exclude is %v, want %v", exclude, want)
+	}
+
+	if pollInterval != 5*time.Second {
+		t.Errorf("poll-interval is %s, want 5s from the environment", pollInterval)
+	}
+
+	if args := flags.Args(); len(args) != 1 || args[0] != "path" {
+		t.Errorf("Arguments are %v, want [path]", args)
+	}
+}
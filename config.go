@@ -0,0 +1,203 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// JobConfig Configuration of a single sync job, a local directory kept in
+// sync with a receiver.
+type JobConfig struct {
+	Name               string            `yaml:"name"`
+	Path               string            `yaml:"path"`
+	Remote             string            `yaml:"remote"`
+	Exclude            []string          `yaml:"exclude"`
+	Watcher            string            `yaml:"watcher"`
+	PollInterval       time.Duration     `yaml:"poll-interval"`
+	ReconcileInterval  time.Duration     `yaml:"reconcile-interval"`
+	ReconcileChecksums bool              `yaml:"reconcile-checksums"`
+	BlockSize          int64             `yaml:"block-size"`
+	Verify             bool              `yaml:"verify"`
+	MaxRetries         int               `yaml:"max-retries"`
+	RPCTimeout         time.Duration     `yaml:"rpc-timeout"`
+	BlockTimeout       time.Duration     `yaml:"block-timeout"`
+	ChecksumTimeout    time.Duration     `yaml:"checksum-timeout"`
+	ListTimeout        time.Duration     `yaml:"list-timeout"`
+	BandwidthLimit     ByteRate          `yaml:"bwlimit"`
+	BandwidthSchedule  BandwidthSchedule `yaml:"bwlimit-schedule"`
+}
+
+// DefaultJobConfig Options a job gets when they are not set.
+func DefaultJobConfig() JobConfig {
+	return JobConfig{
+		Remote:             "127.0.0.1:9090",
+		Watcher:            WatcherAuto,
+		PollInterval:       2 * time.Second,
+		ReconcileChecksums: true,
+		MaxRetries:         DefaultRetryPolicy().MaxRetries,
+		RPCTimeout:         DefaultRPCTimeouts().Default,
+		BlockTimeout:       DefaultRPCTimeouts().Block,
+		ChecksumTimeout:    DefaultRPCTimeouts().Checksum,
+		ListTimeout:        DefaultRPCTimeouts().ListTree,
+	}
+}
+
+// UnmarshalYAML Fill in defaults for options missing in the config file.
+func (jc *JobConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*jc = DefaultJobConfig()
+
+	type jobConfig JobConfig
+	return unmarshal((*jobConfig)(jc))
+}
+
+// Validate Check the options of the job. Path is made absolute.
+func (jc *JobConfig) Validate() []string {
+	var errs []string
+
+	if jc.Name == "" {
+		errs = append(errs, "name is missing")
+	}
+
+	if jc.Path == "" {
+		errs = append(errs, "path is missing")
+	} else if !IsDirectory(jc.Path) {
+		errs = append(errs, fmt.Sprintf("path %s is not a directory", jc.Path))
+	} else if absPath, err := filepath.Abs(jc.Path); err != nil {
+		errs = append(errs, fmt.Sprintf("path %s: %s", jc.Path, err.Error()))
+	} else {
+		jc.Path = absPath
+	}
+
+	if _, port, err := net.SplitHostPort(jc.Remote); err != nil {
+		errs = append(errs, fmt.Sprintf("remote '%s' is not a valid host:port", jc.Remote))
+	} else if !isValidPort(port) {
+		errs = append(errs, fmt.Sprintf("remote '%s' has an invalid port number", jc.Remote))
+	}
+
+	if _, err := NewExcludeFilter(jc.Exclude); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	switch jc.Watcher {
+	case WatcherAuto, WatcherInotify, WatcherFanotify, WatcherPoll:
+	default:
+		errs = append(errs, fmt.Sprintf("unknown watcher '%s', supported watchers are %s, %s, %s and %s",
+			jc.Watcher, WatcherAuto, WatcherInotify, WatcherFanotify, WatcherPoll))
+	}
+
+	if jc.PollInterval <= 0 {
+		errs = append(errs, "poll-interval has to be positive")
+	}
+
+	if jc.ReconcileInterval < 0 {
+		errs = append(errs, "reconcile-interval can't be negative")
+	}
+
+	if jc.MaxRetries < 0 {
+		errs = append(errs, "max-retries can't be negative")
+	}
+
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"rpc-timeout", jc.RPCTimeout},
+		{"block-timeout", jc.BlockTimeout},
+		{"checksum-timeout", jc.ChecksumTimeout},
+		{"list-timeout", jc.ListTimeout},
+	}
+
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Sprintf("%s can't be negative", timeout.name))
+		}
+	}
+
+	if jc.BlockSize < 0 || jc.BlockSize > maxBlockSize {
+		errs = append(errs, fmt.Sprintf("block-size has to be between 0 and %d", maxBlockSize))
+	}
+
+	return errs
+}
+
+// Config Configuration file of the sync command.
+type Config struct {
+	Jobs []JobConfig `yaml:"jobs"`
+}
+
+// LoadConfig Read and validate a config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config: %s", err.Error())
+	}
+
+	config := &Config{}
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", path, err.Error())
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config %s:\n%s", path, err.Error())
+	}
+
+	return config, nil
+}
+
+// Validate Check all jobs and report every problem found, not only the first.
+func (c *Config) Validate() error {
+	var errs []string
+
+	if len(c.Jobs) == 0 {
+		errs = append(errs, "no jobs defined")
+	}
+
+	names := make(map[string]int)
+
+	for i := range c.Jobs {
+		job := &c.Jobs[i]
+
+		where := fmt.Sprintf("jobs[%d]", i)
+		if job.Name != "" {
+			where = fmt.Sprintf("job '%s'", job.Name)
+		}
+
+		for _, err := range job.Validate() {
+			errs = append(errs, fmt.Sprintf("%s: %s", where, err))
+		}
+
+		if first, ok := names[job.Name]; ok && job.Name != "" {
+			errs = append(errs, fmt.Sprintf("%s: name is already used by jobs[%d]", where, first))
+		} else {
+			names[job.Name] = i
+		}
+	}
+
+	// Two jobs syncing to the same receiver would overwrite each other.
+	remotes := make(map[string]string)
+	for _, job := range c.Jobs {
+		if other, ok := remotes[job.Remote]; ok && job.Name != other {
+			errs = append(errs, fmt.Sprintf("job '%s': remote %s is already used by job '%s'", job.Name, job.Remote, other))
+		} else {
+			remotes[job.Remote] = job.Name
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("\t%s", strings.Join(errs, "\n\t"))
+}
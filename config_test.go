@@ -0,0 +1,162 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJob A valid job syncing dir.
+func testJob(name, dir, remote string) JobConfig {
+	job := DefaultJobConfig()
+	job.Name = name
+	job.Path = dir
+	job.Remote = remote
+
+	return job
+}
+
+func TestConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		jobs    func() []JobConfig
+		wantErr []string
+	}{
+		{
+			name: "valid",
+			jobs: func() []JobConfig {
+				return []JobConfig{testJob("a", dir, "host:9090"), testJob("b", dir, "host:9091")}
+			},
+		},
+		{
+			name:    "no jobs",
+			jobs:    func() []JobConfig { return nil },
+			wantErr: []string{"no jobs defined"},
+		},
+		{
+			name: "missing name and path",
+			jobs: func() []JobConfig {
+				return []JobConfig{testJob("", "", "host:9090")}
+			},
+			wantErr: []string{"jobs[0]: name is missing", "jobs[0]: path is missing"},
+		},
+		{
+			name: "path is a file",
+			jobs: func() []JobConfig {
+				return []JobConfig{testJob("a", file, "host:9090")}
+			},
+			wantErr: []string{"job 'a': path " + file + " is not a directory"},
+		},
+		{
+			name: "invalid remotes",
+			jobs: func() []JobConfig {
+				return []JobConfig{testJob("a", dir, "host"), testJob("b", dir, "host:70000")}
+			},
+			wantErr: []string{"job 'a': remote 'host' is not a valid host:port", "job 'b': remote 'host:70000' has an invalid port number"},
+		},
+		{
+			name: "duplicate name",
+			jobs: func() []JobConfig {
+				return []JobConfig{testJob("a", dir, "host:9090"), testJob("a", dir, "host:9091")}
+			},
+			wantErr: []string{"job 'a': name is already used by jobs[0]"},
+		},
+		{
+			name: "same remote",
+			jobs: func() []JobConfig {
+				return []JobConfig{testJob("a", dir, "host:9090"), testJob("b", dir, "host:9090")}
+			},
+			wantErr: []string{"job 'b': remote host:9090 is already used by job 'a'"},
+		},
+		{
+			name: "invalid options",
+			jobs: func() []JobConfig {
+				job := testJob("a", dir, "host:9090")
+				job.Exclude = []string{"[a"}
+				job.Watcher = "magic"
+				job.PollInterval = 0
+				job.ReconcileInterval = -time.Second
+				job.BlockSize = maxBlockSize + 1
+				job.MaxRetries = -1
+				job.RPCTimeout = -time.Second
+				job.ListTimeout = -time.Second
+
+				return []JobConfig{job}
+			},
+			wantErr: []string{
+				"job 'a': Invalid exclude pattern '[a'",
+				"job 'a': unknown watcher 'magic'",
+				"job 'a': poll-interval has to be positive",
+				"job 'a': reconcile-interval can't be negative",
+				"job 'a': block-size has to be between 0 and",
+				"job 'a': max-retries can't be negative",
+				"job 'a': rpc-timeout can't be negative",
+				"job 'a': list-timeout can't be negative",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{Jobs: test.jobs()}
+			err := config.Validate()
+
+			if len(test.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate failed: %s", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Validate didn't fail, want %q", test.wantErr)
+			}
+
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(test.wantErr) {
+				t.Errorf("Validate reported %d problems, want %d:\n%s", len(lines), len(test.wantErr), err)
+			}
+
+			for _, want := range test.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate error is missing %q:\n%s", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestJobConfigValidateMakesPathAbsolute(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := filepath.Rel(cwd, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := testJob("a", dir, "host:9090")
+	if errs := job.Validate(); len(errs) > 0 {
+		t.Fatalf("Validate failed: %s", strings.Join(errs, ", "))
+	}
+
+	if !filepath.IsAbs(job.Path) {
+		t.Errorf("Path = %s, want an absolute path", job.Path)
+	}
+}
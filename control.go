@@ -0,0 +1,544 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statusQueueItems Number of queued items included in a status report.
+const statusQueueItems = 20
+
+// StatusReport What a running sync process is doing, as served on /status
+// of the control socket.
+type StatusReport struct {
+	Version string      `json:"version"`
+	PID     int         `json:"pid"`
+	Started time.Time   `json:"started"`
+	Jobs    []JobStatus `json:"jobs"`
+}
+
+// JobStatus State of a single job.
+type JobStatus struct {
+	Name         string          `json:"name"`
+	Path         string          `json:"path"`
+	Remote       string          `json:"remote"`
+	Connection   string          `json:"connection"`
+	Bandwidth    ByteRate        `json:"bandwidth_limit"`
+	Receiver     string          `json:"receiver_version"`
+	Protocol     uint32          `json:"protocol_version"`
+	QueueLength  int             `json:"queue_length"`
+	Queue        []QueueEntry    `json:"queue"`
+	InFlight     *InFlightStatus `json:"in_flight,omitempty"`
+	Processed    map[string]int  `json:"processed"`
+	Failed       int             `json:"failed"`
+	BytesSent    int64           `json:"bytes_sent"`
+	BytesSkipped int64           `json:"bytes_skipped"`
+	RecentErrors []ErrorStatus   `json:"recent_errors"`
+}
+
+// QueueEntry An item in the queue of a job.
+type QueueEntry struct {
+	Action   string `json:"action"`
+	Path     string `json:"path"`
+	To       string `json:"to,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// newQueueEntry Create a QueueEntry from a queue item.
+func newQueueEntry(item QueueItem) QueueEntry {
+	return QueueEntry{
+		Action:   item.ActionName(),
+		Path:     item.Path,
+		To:       item.RenamePath,
+		Attempts: item.Attempts,
+	}
+}
+
+// InFlightStatus The item being transferred, with the progress of the file
+// when data is being sent.
+type InFlightStatus struct {
+	QueueEntry
+	BlocksDone  int64      `json:"blocks_done,omitempty"`
+	BlocksTotal int64      `json:"blocks_total,omitempty"`
+	BytesDone   int64      `json:"bytes_done,omitempty"`
+	BytesTotal  int64      `json:"bytes_total,omitempty"`
+	Started     *time.Time `json:"started,omitempty"`
+}
+
+// ErrorStatus An item that failed to transfer.
+type ErrorStatus struct {
+	QueueEntry
+	Time  time.Time `json:"time"`
+	Code  string    `json:"code"`
+	Error string    `json:"error"`
+}
+
+// newErrorStatus Create an ErrorStatus from a failed item.
+func newErrorStatus(failed FailedItem) ErrorStatus {
+	return ErrorStatus{
+		QueueEntry: newQueueEntry(failed.Item),
+		Time:       failed.Time,
+		Code:       errorCode(failed.Err).String(),
+		Error:      failed.Err.Error(),
+	}
+}
+
+// FailedStatus Items of a job that failed for good, as served on /failed, or
+// that were queued again, as served on /retry.
+type FailedStatus struct {
+	Job   string        `json:"job"`
+	Items []ErrorStatus `json:"items"`
+}
+
+// RetryRequest Queue the failed items with one of Paths again, or all of
+// them if Paths is empty. Only the items of Job if it is not empty.
+type RetryRequest struct {
+	Job   string   `json:"job"`
+	Paths []string `json:"paths"`
+}
+
+// BandwidthStatus Bandwidth limits of a job, as served on /bwlimit.
+type BandwidthStatus struct {
+	Job      string   `json:"job"`
+	Limit    ByteRate `json:"limit"`
+	Override bool     `json:"override"`
+	Default  ByteRate `json:"default"`
+	Schedule []string `json:"schedule"`
+}
+
+// BandwidthRequest Change the bandwidth limit of a job, or of all jobs if Job
+// is empty. Reset goes back to the limits of the config.
+type BandwidthRequest struct {
+	Job   string `json:"job"`
+	Limit string `json:"limit"`
+	Reset bool   `json:"reset"`
+}
+
+// defaultControlSocket Path of the control socket unless -control-socket is
+// given, one per user. It is kept in $XDG_RUNTIME_DIR when set, otherwise in a
+// directory of our own in the temp directory.
+func defaultControlSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "filewatcher.sock")
+	}
+
+	return filepath.Join(privateSocketDir(), "control.sock")
+}
+
+// privateSocketDir Directory in the temp directory for the default control
+// socket, only accessible to the user.
+func privateSocketDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("filewatcher-%d", os.Getuid()))
+}
+
+// makePrivateDir Create dir for us only, or check that an existing one is
+// ours and closed to everyone else. Anyone can create it in the temp
+// directory before we do.
+func makePrivateDir(dir string) error {
+	err := os.Mkdir(dir, 0700)
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("Failed to create %s: %s", dir, err.Error())
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("Failed to stat %s: %s", dir, err.Error())
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	if uid, ok := FileOwner(info); ok && uid != os.Getuid() {
+		return fmt.Errorf("%s belongs to another user", dir)
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is accessible to other users", dir)
+	}
+
+	return nil
+}
+
+// ControlServer Serves the state of a running sync process as JSON over
+// HTTP on a Unix domain socket, for the status command.
+type ControlServer struct {
+	path     string
+	listener net.Listener
+	mux      *http.ServeMux
+	jobs     func() []*Job
+	started  time.Time
+}
+
+// NewControlServer Create new instance of ControlServer listening on path,
+// reporting on the jobs returned by jobs. A stale socket left by a process
+// that is gone is replaced, one in use or of another user is not.
+func NewControlServer(path string, jobs func() []*Job) (*ControlServer, error) {
+	if filepath.Dir(path) == privateSocketDir() {
+		if err := makePrivateDir(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if uid, ok := FileOwner(info); ok && uid != os.Getuid() {
+			return nil, fmt.Errorf("Control socket %s belongs to another user", path)
+		}
+
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Control socket %s is in use by another process", path)
+		}
+
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on control socket %s: %s", path, err.Error())
+	}
+
+	// Only the user running us gets to control us.
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("Failed to chmod control socket %s: %s", path, err.Error())
+	}
+
+	c := &ControlServer{
+		path:     path,
+		listener: listener,
+		mux:      http.NewServeMux(),
+		jobs:     jobs,
+		started:  time.Now(),
+	}
+
+	c.mux.HandleFunc("/status", c.handleStatus)
+	c.mux.HandleFunc("/bwlimit", c.handleBandwidth)
+	c.mux.HandleFunc("/failed", c.handleFailed)
+	c.mux.HandleFunc("/retry", c.handleRetry)
+
+	return c, nil
+}
+
+// Start serving in the background.
+func (c *ControlServer) Start() {
+	logger.Debug("Serving control socket", Fields{"path": c.path})
+
+	go http.Serve(c.listener, c.mux)
+}
+
+// Close Stop serving and remove the socket. Does nothing if c is nil.
+func (c *ControlServer) Close() {
+	if c == nil {
+		return
+	}
+
+	c.listener.Close()
+	os.Remove(c.path)
+}
+
+// handleStatus Serve a StatusReport.
+func (c *ControlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+
+	report := StatusReport{
+		Version: version,
+		PID:     os.Getpid(),
+		Started: c.started,
+		Jobs:    []JobStatus{},
+	}
+
+	for _, job := range c.jobs() {
+		report.Jobs = append(report.Jobs, job.Status())
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleBandwidth Serve the bandwidth limits of the jobs on GET, and change
+// them on POST.
+func (c *ControlServer) handleBandwidth(w http.ResponseWriter, r *http.Request) {
+	jobs := c.jobs()
+
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPost:
+		req := BandwidthRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("Invalid request: %s", err.Error()))
+			return
+		}
+
+		var limit ByteRate
+		if !req.Reset {
+			var err error
+			if limit, err = ParseByteRate(req.Limit); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		var matched []*Job
+		for _, job := range jobs {
+			if req.Job == "" || req.Job == job.Name() {
+				matched = append(matched, job)
+			}
+		}
+
+		if len(matched) == 0 {
+			writeJSONError(w, http.StatusNotFound, fmt.Errorf("No job named '%s'", req.Job))
+			return
+		}
+
+		for _, job := range matched {
+			if req.Reset {
+				job.Limiter().ClearOverride()
+				job.logger.Info("Bandwidth limit reset", Fields{"bwlimit": job.Limiter().Limit()})
+			} else {
+				job.Limiter().SetOverride(limit)
+				job.logger.Info("Bandwidth limit changed", Fields{"bwlimit": limit})
+			}
+		}
+
+		jobs = matched
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+
+	limits := []BandwidthStatus{}
+	for _, job := range jobs {
+		limits = append(limits, job.BandwidthStatus())
+	}
+
+	writeJSON(w, http.StatusOK, limits)
+}
+
+// handleFailed Serve the items of every job that failed for good.
+func (c *ControlServer) handleFailed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+
+	failed := []FailedStatus{}
+	for _, job := range c.jobs() {
+		failed = append(failed, job.Failed())
+	}
+
+	writeJSON(w, http.StatusOK, failed)
+}
+
+// handleRetry Queue failed items again and serve the items that were.
+func (c *ControlServer) handleRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+
+	req := RetryRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("Invalid request: %s", err.Error()))
+		return
+	}
+
+	retried := []FailedStatus{}
+	for _, job := range c.jobs() {
+		if req.Job == "" || req.Job == job.Name() {
+			retried = append(retried, job.Retry(req.Paths))
+		}
+	}
+
+	if len(retried) == 0 {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("No job named '%s'", req.Job))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, retried)
+}
+
+// writeJSON Write v as the JSON body of a response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeJSONError Write err as the JSON body of a response.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// controlRequest Make a request to the control socket of a running sync
+// process. body is sent as JSON if not nil, and the response is decoded into
+// out if not nil.
+func controlRequest(socketPath, method, path string, body interface{}, out interface{}) error {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	// The host is not used, the connection always goes to the socket.
+	req, err := http.NewRequest(method, "http://filewatcher"+path, reqBody)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to reach sync process on %s, is it running? %s", socketPath, err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var respErr struct {
+			Error string `json:"error"`
+		}
+
+		if json.NewDecoder(resp.Body).Decode(&respErr) != nil || respErr.Error == "" {
+			respErr.Error = resp.Status
+		}
+
+		return fmt.Errorf("%s", respErr.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("Failed to decode response: %s", err.Error())
+	}
+
+	return nil
+}
+
+// printStatus Print a status report for humans.
+func printStatus(out io.Writer, report *StatusReport) {
+	fmt.Fprintf(out, "filewatcher %s, pid %d, up %s\n", report.Version, report.PID,
+		time.Since(report.Started).Round(time.Second))
+
+	for _, job := range report.Jobs {
+		fmt.Fprintf(out, "\nJob %s (%s -> %s)\n", job.Name, job.Path, job.Remote)
+		fmt.Fprintf(out, "\tConnection\t%s\n", job.Connection)
+		fmt.Fprintf(out, "\tReceiver\t%s, protocol %d\n", job.Receiver, job.Protocol)
+		fmt.Fprintf(out, "\tBandwidth\t%s\n", job.Bandwidth)
+
+		if inFlight := job.InFlight; inFlight != nil {
+			fmt.Fprintf(out, "\tIn flight\t%s", formatQueueEntry(inFlight.QueueEntry))
+
+			if inFlight.BlocksTotal > 0 {
+				fmt.Fprintf(out, "  %d/%d blocks  %s/%s  %s", inFlight.BlocksDone, inFlight.BlocksTotal,
+					formatBytes(inFlight.BytesDone), formatBytes(inFlight.BytesTotal),
+					formatPercent(inFlight.BytesDone, inFlight.BytesTotal))
+			}
+
+			fmt.Fprintln(out)
+		}
+
+		fmt.Fprintf(out, "\tQueue\t\t%d\n", job.QueueLength)
+		for _, entry := range job.Queue {
+			fmt.Fprintf(out, "\t\t\t%s\n", formatQueueEntry(entry))
+		}
+
+		if len(job.Queue) < job.QueueLength {
+			fmt.Fprintf(out, "\t\t\t... and %d more\n", job.QueueLength-len(job.Queue))
+		}
+
+		var actions []string
+		for action := range job.Processed {
+			actions = append(actions, action)
+		}
+
+		sort.Strings(actions)
+
+		var processed []string
+		for _, action := range actions {
+			processed = append(processed, fmt.Sprintf("%s %d", action, job.Processed[action]))
+		}
+
+		fmt.Fprintf(out, "\tSynced\t\t%s\n", strings.Join(processed, ", "))
+		fmt.Fprintf(out, "\tFailed\t\t%d\n", job.Failed)
+		fmt.Fprintf(out, "\tSent\t\t%s (%s skipped)\n", formatBytes(job.BytesSent), formatBytes(job.BytesSkipped))
+
+		if len(job.RecentErrors) > 0 {
+			fmt.Fprintf(out, "\tRecent errors\n")
+			for _, recent := range job.RecentErrors {
+				fmt.Fprintf(out, "\t\t%s\n", formatErrorStatus(recent))
+			}
+		}
+	}
+}
+
+// printFailed Print the failed items of the jobs for humans.
+func printFailed(out io.Writer, failed []FailedStatus) {
+	for _, job := range failed {
+		fmt.Fprintf(out, "Job %s: %d failed\n", job.Job, len(job.Items))
+
+		for _, item := range job.Items {
+			fmt.Fprintf(out, "\t%s\n", formatErrorStatus(item))
+		}
+	}
+}
+
+// formatErrorStatus Format a failed item as time, action, path, status code
+// and error.
+func formatErrorStatus(item ErrorStatus) string {
+	return fmt.Sprintf("%s  %s: %s: %s", item.Time.Local().Format("2006/01/02 15:04:05"),
+		formatQueueEntry(item.QueueEntry), item.Code, item.Error)
+}
+
+// formatQueueEntry Format a queue entry as action and path, and how many
+// attempts failed if any did.
+func formatQueueEntry(entry QueueEntry) string {
+	s := fmt.Sprintf("%s %s", entry.Action, entry.Path)
+	if entry.To != "" {
+		s += fmt.Sprintf(" -> %s", entry.To)
+	}
+
+	if entry.Attempts > 0 {
+		s += fmt.Sprintf(" (%d failed attempts)", entry.Attempts)
+	}
+
+	return s
+}
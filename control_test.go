@@ -0,0 +1,55 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMakePrivateDir(t *testing.T) {
+	base := t.TempDir()
+
+	open := filepath.Join(base, "open")
+	if err := os.Mkdir(open, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mkdir is subject to the umask, so make sure it is open to others.
+	if err := os.Chmod(open, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(base, "file")
+	writeTestFile(t, file, "")
+
+	tests := []struct {
+		name string
+		dir  string
+		ok   bool
+	}{
+		{"created", filepath.Join(base, "new"), true},
+		{"already ours", filepath.Join(base, "new"), true},
+		{"accessible to others", open, false},
+		{"not a directory", file, false},
+	}
+
+	for _, test := range tests {
+		err := makePrivateDir(test.dir)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: makePrivateDir = %v, want ok %t", test.name, err, test.ok)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(base, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("Created directory has mode %v, want 0700", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// DryRun Compare the local tree to the remote and print what a sync would
+// change. Only the read-only RPCs are used, so the remote is left untouched.
+func DryRun(sender *Sender, exclude *ExcludeFilter, out io.Writer) error {
+	local, err := ListTree(sender.BasePath, true)
+	if err != nil {
+		return fmt.Errorf("Failed to list local tree: %s", err.Error())
+	}
+
+	remote, err := sender.ListTree(true)
+	if err != nil {
+		return fmt.Errorf("Failed to list remote tree: %s", err.Error())
+	}
+
+	var totalBytes, totalBlocks int64
+
+	for _, item := range CompareTree(exclude.FilterTree(local), exclude.FilterTree(remote)).Items {
+		switch {
+		case item.Kind == DriftExtra:
+			fmt.Fprintf(out, "DELETE\t%s\n", item.Path)
+
+		case item.Kind == DriftRenamed:
+			fmt.Fprintf(out, "RENAME\t%s\t%s\n", item.OldPath, item.Path)
+
+		case item.Kind == DriftMode:
+			fmt.Fprintf(out, "CHMOD\t%s\t%04o\n", item.Path, item.Mode)
+
+		case item.IsDir:
+			fmt.Fprintf(out, "MKDIR\t%s\t%04o\n", item.Path, item.Mode)
+
+		default:
+			plan, err := sender.PlanSync(item.Path)
+			if err != nil {
+				fmt.Fprintf(out, "ERROR\t%s\t%s\n", item.Path, err)
+				continue
+			}
+
+			if plan.Create {
+				fmt.Fprintf(out, "CREATE\t%s\t%d blocks\t%d bytes\n", item.Path, plan.MissingBlocks, plan.Bytes)
+			} else {
+				fmt.Fprintf(out, "UPDATE\t%s\t%d of %d blocks\t%d bytes\n", item.Path, plan.MissingBlocks, plan.NumBlocks, plan.Bytes)
+			}
+
+			totalBlocks += plan.MissingBlocks
+			totalBytes += plan.Bytes
+		}
+	}
+
+	fmt.Fprintf(out, "Total: %d bytes in %d blocks would be transferred\n", totalBytes, totalBlocks)
+
+	return nil
+}
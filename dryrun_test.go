@@ -0,0 +1,51 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	remote := t.TempDir()
+	dir := testTree(t)
+
+	content := strings.Repeat("0123456789", 10)
+	changed := content[:35] + "x" + content[36:]
+
+	writeTestFile(t, filepath.Join(dir, "changed"), changed)
+	writeTestFile(t, filepath.Join(dir, "same"), "same")
+	writeTestFile(t, filepath.Join(dir, "moved"), "rename me")
+	writeTestFile(t, filepath.Join(dir, "d", "new"), "new")
+
+	writeTestFile(t, filepath.Join(remote, "changed"), content)
+	writeTestFile(t, filepath.Join(remote, "same"), "same")
+	writeTestFile(t, filepath.Join(remote, "old"), "rename me")
+	writeTestFile(t, filepath.Join(remote, "gone"), "gone")
+
+	sender := connectTestReceiver(t, &testReceiver{root: remote})
+	sender.BasePath = dir
+
+	var out bytes.Buffer
+	if err := DryRun(sender, nil, &out); err != nil {
+		t.Fatalf("DryRun failed: %s", err)
+	}
+
+	want := strings.Join([]string{
+		"MKDIR\td\t0755",
+		"RENAME\told\tmoved",
+		"DELETE\tgone",
+		"UPDATE\tchanged\t1 of 10 blocks\t10 bytes",
+		"CREATE\td/new\t3 blocks\t3 bytes",
+		"Total: 13 bytes in 4 blocks would be transferred",
+	}, "\n") + "\n"
+
+	if out.String() != want {
+		t.Errorf("DryRun printed:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SyncError An operation that failed, with the gRPC status code of what
+// caused it. Failures on our end get the code the receiver would have used,
+// so a file deleted here before it was sent is NotFound too.
+type SyncError struct {
+	Code    codes.Code
+	Message string
+	Err     error
+}
+
+// syncError Wrap err in a SyncError, with what was being done as message.
+// Returns nil if err is nil.
+func syncError(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	return &SyncError{
+		Code:    errorCode(err),
+		Message: fmt.Sprintf(format, args...),
+		Err:     err,
+	}
+}
+
+// Error Describe what failed and why.
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.Err.Error())
+}
+
+// Unwrap Get the cause.
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus Get the error as a status, so status.Code works on it.
+func (e *SyncError) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Error())
+}
+
+// errorCode Get the gRPC status code of err. Errors from the filesystem and
+// context get the code they would have on the receiver.
+func errorCode(err error) codes.Code {
+	if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return status.Code(err)
+	}
+
+	switch {
+	case err == nil:
+		return codes.OK
+	case err == context.Canceled:
+		return codes.Canceled
+	case err == context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	case os.IsNotExist(err):
+		return codes.NotFound
+	case os.IsPermission(err):
+		return codes.PermissionDenied
+	}
+
+	return codes.Unknown
+}
+
+// IsTransient Check if an operation that failed with err may succeed when
+// tried again later, because the receiver was unreachable, too slow or out
+// of resources. Other failures need something to change first.
+func IsTransient(err error) bool {
+	switch errorCode(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), true},
+		{"deadline exceeded", status.Error(codes.DeadlineExceeded, "too slow"), true},
+		{"resource exhausted", status.Error(codes.ResourceExhausted, "disk full"), true},
+		{"not found", status.Error(codes.NotFound, "gone"), false},
+		{"permission denied", status.Error(codes.PermissionDenied, "no"), false},
+		{"invalid argument", status.Error(codes.InvalidArgument, "bad path"), false},
+		{"data loss", status.Error(codes.DataLoss, "checksum mismatch"), false},
+		{"internal", status.Error(codes.Internal, "bug"), false},
+
+		{"context deadline", context.DeadlineExceeded, true},
+		{"context canceled", context.Canceled, false},
+		{"file not found", &os.PathError{Op: "open", Path: "a", Err: os.ErrNotExist}, false},
+		{"file permission", &os.PathError{Op: "open", Path: "a", Err: os.ErrPermission}, false},
+		{"plain error", errors.New("something"), false},
+
+		{"wrapped unavailable", syncError(status.Error(codes.Unavailable, "down"), "Failed to send %s", "a"), true},
+		{"wrapped deadline", syncError(context.DeadlineExceeded, "Failed to send %s", "a"), true},
+		{"wrapped not found", syncError(os.ErrNotExist, "Failed to read %s", "a"), false},
+		{"sync error with code", &SyncError{Code: codes.Unavailable, Message: "Gave up", Err: fmt.Errorf("Not connected")}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsTransient(test.err); got != test.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSyncErrorCode(t *testing.T) {
+	err := syncError(os.ErrNotExist, "Failed to read %s", "a")
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("status.Code = %s, want %s", code, codes.NotFound)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%v doesn't unwrap to os.ErrNotExist", err)
+	}
+
+	if syncError(nil, "Failed") != nil {
+		t.Errorf("syncError of nil isn't nil")
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ExcludeFilter Decides which paths of a job are not synced.
+//
+// A pattern without a slash is matched against every component of the path,
+// so "*.tmp" excludes temporary files anywhere in the tree and "node_modules"
+// every directory with that name. A pattern with a slash is matched against
+// the path relative to the root of the job, "build/cache" only excludes that
+// one directory, and so is a pattern starting with a slash, "/build" only
+// excludes build at the root. "**" matches any number of directories, so
+// "docs/**/*.pdf" excludes PDFs anywhere below docs. A pattern ending with a
+// slash only excludes directories. Everything below an excluded directory is
+// excluded too.
+type ExcludeFilter struct {
+	patterns []excludePattern
+}
+
+// excludePattern A parsed exclude pattern, split on slashes.
+type excludePattern struct {
+	parts   []string
+	dirOnly bool
+}
+
+// NewExcludeFilter Create new instance of ExcludeFilter.
+func NewExcludeFilter(patterns []string) (*ExcludeFilter, error) {
+	filter := &ExcludeFilter{}
+
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("Empty exclude pattern")
+		}
+
+		parts := strings.Split(pattern, "/")
+		for _, part := range parts {
+			if _, err := filepath.Match(part, ""); err != nil {
+				return nil, fmt.Errorf("Invalid exclude pattern '%s': %s", pattern, err.Error())
+			}
+		}
+
+		if !anchored {
+			parts = append([]string{"**"}, parts...)
+		}
+
+		filter.patterns = append(filter.patterns, excludePattern{parts: parts, dirOnly: dirOnly})
+	}
+
+	return filter, nil
+}
+
+// Match Check if a path relative to the root of the job is excluded. isDir
+// tells if the path itself is a directory.
+func (e *ExcludeFilter) Match(path string, isDir bool) bool {
+	if e == nil || len(e.patterns) == 0 {
+		return false
+	}
+
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path == "." {
+		return false
+	}
+
+	parts := strings.Split(path, "/")
+
+	for _, pattern := range e.patterns {
+		// Every parent is a directory, only the path itself might not be.
+		for i := range parts {
+			if pattern.dirOnly && i == len(parts)-1 && !isDir {
+				continue
+			}
+
+			if matchParts(pattern.parts, parts[:i+1]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchParts Match the components of a path against those of a pattern,
+// where "**" matches any number of components. At the end of a pattern it
+// has to match at least one, "build/**" excludes what is in build but not
+// build itself.
+func matchParts(pattern []string, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		first := 0
+		if len(pattern) == 1 {
+			first = 1
+		}
+
+		for i := first; i <= len(parts); i++ {
+			if matchParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+
+	if matched, _ := filepath.Match(pattern[0], parts[0]); !matched {
+		return false
+	}
+
+	return matchParts(pattern[1:], parts[1:])
+}
+
+// FilterTree Remove excluded entries from a tree listing.
+func (e *ExcludeFilter) FilterTree(entries []*TreeEntry) []*TreeEntry {
+	if e == nil || len(e.patterns) == 0 {
+		return entries
+	}
+
+	var filtered []*TreeEntry
+	for _, entry := range entries {
+		if !e.Match(entry.GetPath(), entry.GetIsDir()) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,107 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import "testing"
+
+func TestExcludeFilterMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"no patterns", nil, "a.tmp", false, false},
+		{"root", []string{"*"}, ".", true, false},
+
+		{"name anywhere", []string{"*.tmp"}, "a/b/c.tmp", false, true},
+		{"name at root", []string{"*.tmp"}, "c.tmp", false, true},
+		{"name not matching", []string{"*.tmp"}, "a/b/c.txt", false, false},
+		{"below excluded name", []string{"node_modules"}, "web/node_modules/x/index.js", false, true},
+		{"name is not a substring match", []string{"cache"}, "a/cachefile", false, false},
+
+		{"path with slash", []string{"build/cache"}, "build/cache", true, true},
+		{"below path with slash", []string{"build/cache"}, "build/cache/obj/a.o", false, true},
+		{"path with slash is anchored", []string{"build/cache"}, "src/build/cache", true, false},
+		{"leading slash", []string{"/build"}, "build", true, true},
+		{"below leading slash", []string{"/build"}, "build/a.o", false, true},
+		{"leading slash is anchored", []string{"/build"}, "src/build", true, false},
+		{"leading slash with glob", []string{"/*.log"}, "a.log", false, true},
+		{"leading slash with glob in subdirectory", []string{"/*.log"}, "logs/a.log", false, false},
+
+		{"dir only matches directory", []string{"cache/"}, "a/cache", true, true},
+		{"dir only skips file", []string{"cache/"}, "a/cache", false, false},
+		{"below dir only", []string{"cache/"}, "a/cache/b", false, true},
+		{"anchored dir only", []string{"/tmp/"}, "tmp", true, true},
+		{"anchored dir only skips file", []string{"/tmp/"}, "tmp", false, false},
+		{"anchored dir only in subdirectory", []string{"/tmp/"}, "a/tmp", true, false},
+
+		{"double star in the middle", []string{"docs/**/*.pdf"}, "docs/a/b/c.pdf", false, true},
+		{"double star matches no directory", []string{"docs/**/*.pdf"}, "docs/c.pdf", false, true},
+		{"double star outside prefix", []string{"docs/**/*.pdf"}, "src/docs/c.pdf", false, false},
+		{"leading double star", []string{"**/cache"}, "a/b/cache", true, true},
+		{"leading double star at root", []string{"**/cache"}, "cache", true, true},
+		{"trailing double star", []string{"build/**"}, "build/a/b.o", false, true},
+		{"trailing double star skips directory itself", []string{"build/**"}, "build", true, false},
+		{"single star stays in one directory", []string{"docs/*.pdf"}, "docs/a/c.pdf", false, false},
+
+		{"second pattern matches", []string{"*.tmp", "*.log"}, "a.log", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := NewExcludeFilter(test.patterns)
+			if err != nil {
+				t.Fatalf("NewExcludeFilter(%q) failed: %s", test.patterns, err)
+			}
+
+			if got := filter.Match(test.path, test.isDir); got != test.want {
+				t.Errorf("Match(%q, %v) with %q = %v, want %v", test.path, test.isDir, test.patterns, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewExcludeFilterInvalid(t *testing.T) {
+	for _, pattern := range []string{"", "/", "[a", "a/[b"} {
+		if _, err := NewExcludeFilter([]string{pattern}); err == nil {
+			t.Errorf("NewExcludeFilter(%q) didn't fail", pattern)
+		}
+	}
+}
+
+func TestTransferManagerExcludesByItemType(t *testing.T) {
+	filter, err := NewExcludeFilter([]string{"cache/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		item QueueItem
+		want bool
+	}{
+		{"delete of a file", QueueItem{Action: TmActionDelete, Path: "cache"}, true},
+		{"delete of a directory", QueueItem{Action: TmActionDelete, Path: "cache", IsDir: true}, false},
+		{"mkdir", QueueItem{Action: TmActionMkdir, Path: "cache"}, false},
+		{"write", QueueItem{Action: TmActionWrite, Path: "cache"}, true},
+		{"below directory", QueueItem{Action: TmActionWrite, Path: "cache/a"}, false},
+		{"rename of a file", QueueItem{Action: TmActionRename, Path: "a", RenamePath: "cache"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The paths don't exist, whether they are directories has to
+			// come from the item.
+			tm := NewTransferManager(NewSender(), t.TempDir(), filter, newJobMetrics("test"))
+			tm.Add(test.item)
+
+			if queued := len(tm.queue) == 1; queued != test.want {
+				t.Errorf("Add(%+v) queued = %v, want %v", test.item, queued, test.want)
+			}
+		})
+	}
+}
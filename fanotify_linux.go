@@ -0,0 +1,330 @@
+//go:build linux
+// +build linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const fanotifyMask = unix.FAN_CREATE | unix.FAN_MODIFY | unix.FAN_ATTRIB | unix.FAN_DELETE |
+	unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO | unix.FAN_ONDIR
+
+// maxOutsideDirs Number of directories outside the sync root we remember.
+// The mark covers the whole filesystem, so they are forgotten when there are
+// more rather than piling up.
+const maxOutsideDirs = 65536
+
+// errOutsideRoot The directory of an event is outside the sync root.
+var errOutsideRoot = errors.New("Directory is outside the sync root")
+
+const fanotifyInitFlags = unix.FAN_CLASS_NOTIF | unix.FAN_REPORT_DFID_NAME |
+	unix.FAN_UNLIMITED_QUEUE | unix.FAN_CLOEXEC | unix.FAN_NONBLOCK
+
+// Fanotify watches a whole filesystem with a single fanotify mark and filters
+// the events down to the sync root. Unlike inotify this needs no watch per
+// directory, but it requires CAP_SYS_ADMIN and Linux 5.9 or newer for
+// FAN_REPORT_DFID_NAME.
+type Fanotify struct {
+	events chan WatchEvent
+	errors chan error
+
+	fh       *os.File
+	mountFd  int
+	basePath string
+
+	// Resolved handles give us the real path, which differs from basePath
+	// if it goes through a symlink.
+	realBase string
+
+	// Directory handles in the sync root resolved to paths, and those
+	// outside it. Both are cleared when a directory moves, since it may have
+	// moved into or out of the root.
+	dirs    map[string]string
+	outside map[string]bool
+
+	// fanotify has no move cookies, the two halves of a rename are queued
+	// back to back so we pair a MOVED_TO with the MOVED_FROM right before it.
+	cookie       uint32
+	lastMoveFrom bool
+}
+
+// FanotifyAvailable Check if the kernel supports fanotify with directory
+// entry events and that we are allowed to use it.
+func FanotifyAvailable() bool {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_REPORT_DFID_NAME|unix.FAN_CLOEXEC, unix.O_RDONLY)
+	if err != nil {
+		return false
+	}
+
+	unix.Close(fd)
+	return true
+}
+
+// NewFanotify Create new fanotify instance watching the filesystem basePath is on.
+func NewFanotify(basePath string) (*Fanotify, error) {
+	fd, err := unix.FanotifyInit(fanotifyInitFlags, unix.O_RDONLY|unix.O_LARGEFILE)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify_init: %s", err.Error())
+	}
+
+	err = unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, fanotifyMask, unix.AT_FDCWD, basePath)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("fanotify_mark %s: %s", basePath, err.Error())
+	}
+
+	// Any descriptor on the filesystem works as mount fd for open_by_handle_at.
+	mountFd, err := unix.Open(basePath, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("open %s: %s", basePath, err.Error())
+	}
+
+	realBase, err := filepath.EvalSymlinks(basePath)
+	if err != nil {
+		realBase = basePath
+	}
+
+	fn := &Fanotify{
+		events:   make(chan WatchEvent),
+		errors:   make(chan error),
+		fh:       os.NewFile(uintptr(fd), "fanotify"),
+		mountFd:  mountFd,
+		basePath: basePath,
+		realBase: realBase,
+		dirs:     make(map[string]string),
+		outside:  make(map[string]bool),
+	}
+
+	go fn.readEvents()
+
+	return fn, nil
+}
+
+// Events Channel of decoded events.
+func (fn *Fanotify) Events() <-chan WatchEvent {
+	return fn.events
+}
+
+// Errors Channel of errors from reading events.
+func (fn *Fanotify) Errors() <-chan error {
+	return fn.errors
+}
+
+// Add The whole filesystem is already watched.
+func (fn *Fanotify) Add(path string) error {
+	return nil
+}
+
+// Remove The whole filesystem is watched, events are filtered by path.
+func (fn *Fanotify) Remove(path string) {}
+
+// Rename Paths are resolved per event, so there is nothing to update.
+func (fn *Fanotify) Rename(oldPath string, newPath string) {}
+
+// Close the fanotify instance, this will also stop the reader.
+func (fn *Fanotify) Close() error {
+	unix.Close(fn.mountFd)
+	return fn.fh.Close()
+}
+
+// resolveDir Get the current path of the directory a file handle refers to.
+// Returns errOutsideRoot for directories outside the sync root.
+func (fn *Fanotify) resolveDir(handleType int32, handle []byte) (string, error) {
+	key := strconv.Itoa(int(handleType)) + ":" + string(handle)
+	if path, ok := fn.dirs[key]; ok {
+		return path, nil
+	}
+
+	if fn.outside[key] {
+		return "", errOutsideRoot
+	}
+
+	fd, err := unix.OpenByHandleAt(fn.mountFd, unix.NewFileHandle(handleType, handle), unix.O_PATH|unix.O_CLOEXEC)
+	if err != nil {
+		return "", err
+	}
+
+	defer unix.Close(fd)
+
+	path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+	if err != nil {
+		return "", err
+	}
+
+	if path != fn.realBase && !strings.HasPrefix(path, fn.realBase+"/") {
+		if len(fn.outside) >= maxOutsideDirs {
+			fn.outside = make(map[string]bool)
+		}
+
+		fn.outside[key] = true
+		return "", errOutsideRoot
+	}
+
+	fn.dirs[key] = path
+
+	return path, nil
+}
+
+// parseEvent Turn a raw fanotify event into a WatchEvent. Returns false for
+// events outside the sync root or that can't be resolved.
+func (fn *Fanotify) parseEvent(meta *unix.FanotifyEventMetadata, info []byte) (WatchEvent, bool) {
+	event := WatchEvent{IsDir: meta.Mask&unix.FAN_ONDIR != 0}
+
+	// Directories moving or disappearing invalidate our cached paths.
+	if event.IsDir && meta.Mask&(unix.FAN_MOVED_FROM|unix.FAN_DELETE) != 0 {
+		fn.dirs = make(map[string]string)
+		fn.outside = make(map[string]bool)
+	}
+
+	for len(info) >= 4 {
+		infoType := info[0]
+		infoLen := int(binary.LittleEndian.Uint16(info[2:4]))
+		if infoLen < 4 || infoLen > len(info) {
+			break
+		}
+
+		record := info[:infoLen]
+		info = info[infoLen:]
+
+		// Header (4 bytes), fsid (8 bytes), handle_bytes and handle_type (4 bytes each).
+		if infoType != unix.FAN_EVENT_INFO_TYPE_DFID_NAME || len(record) < 20 {
+			continue
+		}
+
+		handleBytes := int(binary.LittleEndian.Uint32(record[12:16]))
+		handleType := int32(binary.LittleEndian.Uint32(record[16:20]))
+		if 20+handleBytes > len(record) {
+			continue
+		}
+
+		name := record[20+handleBytes:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+
+		dir, err := fn.resolveDir(handleType, record[20:20+handleBytes])
+		if err != nil {
+			return event, false
+		}
+
+		event.Path = filepath.Join(dir, string(name))
+	}
+
+	if event.Path == "" || !strings.HasPrefix(event.Path, fn.realBase+"/") {
+		return event, false
+	}
+
+	event.Path = fn.basePath + strings.TrimPrefix(event.Path, fn.realBase)
+
+	return event, true
+}
+
+// fanotifyOps Order in which we report the operations of a merged event.
+var fanotifyOps = []struct {
+	mask uint64
+	op   WatchOp
+}{
+	{unix.FAN_MOVED_FROM, WatchMovedFrom},
+	{unix.FAN_MOVED_TO, WatchMovedTo},
+	{unix.FAN_CREATE, WatchCreate},
+	{unix.FAN_MODIFY, WatchWrite},
+	{unix.FAN_ATTRIB, WatchChmod},
+	{unix.FAN_DELETE, WatchRemove},
+}
+
+// readEvents Read and decode events until the fanotify instance is closed.
+func (fn *Fanotify) readEvents() {
+	defer close(fn.events)
+	defer close(fn.errors)
+
+	var buf [65536]byte
+	metaSize := int(unsafe.Sizeof(unix.FanotifyEventMetadata{}))
+	failures := 0
+
+	for {
+		n, err := fn.fh.Read(buf[:])
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+
+			failures++
+			fn.errors <- err
+			time.Sleep(readRetryDelay(failures))
+			continue
+		}
+
+		failures = 0
+
+		for offset := 0; offset+metaSize <= n; {
+			meta := (*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[offset]))
+			if meta.Event_len < uint32(metaSize) || offset+int(meta.Event_len) > n {
+				break
+			}
+
+			info := buf[offset+int(meta.Metadata_len) : offset+int(meta.Event_len)]
+			offset += int(meta.Event_len)
+
+			if meta.Mask&unix.FAN_Q_OVERFLOW != 0 {
+				fn.lastMoveFrom = false
+				fn.events <- WatchEvent{Op: WatchOverflow}
+				continue
+			}
+
+			isMoveFrom := meta.Mask&unix.FAN_MOVED_FROM != 0
+			isMoveTo := meta.Mask&unix.FAN_MOVED_TO != 0
+
+			if isMoveFrom {
+				fn.cookie++
+			} else if isMoveTo && !fn.lastMoveFrom {
+				// Moved in from somewhere we don't watch, make sure it
+				// doesn't pair with an older move.
+				fn.cookie++
+			}
+
+			fn.lastMoveFrom = isMoveFrom
+
+			event, ok := fn.parseEvent(meta, info)
+			if !ok {
+				continue
+			}
+
+			event.Cookie = fn.cookie
+
+			// fanotify merges events on the same entry, like a create
+			// followed by a write, so one event can carry several operations.
+			// If the entry still exists after a delete it was recreated, so
+			// the delete has to go first.
+			mask := meta.Mask
+			if _, err := os.Lstat(event.Path); err == nil && mask&unix.FAN_DELETE != 0 {
+				event.Op = WatchRemove
+				fn.events <- event
+				mask &^= unix.FAN_DELETE
+			}
+
+			for _, op := range fanotifyOps {
+				if mask&op.mask != 0 {
+					event.Op = op.op
+					fn.events <- event
+				}
+			}
+		}
+	}
+}
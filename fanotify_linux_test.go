@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFanotifyResolveDirCachesOutsideRoot(t *testing.T) {
+	if !FanotifyAvailable() {
+		t.Skip("fanotify is not available")
+	}
+
+	base := testTree(t)
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+
+	for _, dir := range []string{root, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mountFd, err := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := &Fanotify{
+		mountFd:  mountFd,
+		basePath: root,
+		realBase: root,
+		dirs:     make(map[string]string),
+		outside:  make(map[string]bool),
+	}
+
+	resolve := func(path string) (string, error) {
+		handle, _, err := unix.NameToHandleAt(unix.AT_FDCWD, path, 0)
+		if err != nil {
+			t.Skipf("The filesystem doesn't support file handles: %s", err)
+		}
+
+		return fn.resolveDir(handle.Type(), handle.Bytes())
+	}
+
+	if path, err := resolve(root); err != nil || path != root {
+		t.Fatalf("resolveDir of the root = %q, %v", path, err)
+	}
+
+	if _, err := resolve(outside); err != errOutsideRoot {
+		t.Fatalf("resolveDir of a directory outside the root returned %v, want errOutsideRoot", err)
+	}
+
+	// Both are answered from the caches once the handles can't be opened.
+	unix.Close(mountFd)
+	fn.mountFd = -1
+
+	if path, err := resolve(root); err != nil || path != root {
+		t.Errorf("resolveDir of the root wasn't cached: %q, %v", path, err)
+	}
+
+	if _, err := resolve(outside); err != errOutsideRoot {
+		t.Errorf("resolveDir of the directory outside wasn't cached: %v", err)
+	}
+
+	if len(fn.dirs) != 1 || len(fn.outside) != 1 {
+		t.Errorf("%d directories cached in the root and %d outside, want 1 of each", len(fn.dirs), len(fn.outside))
+	}
+}
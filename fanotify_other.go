@@ -0,0 +1,39 @@
+//go:build !linux
+// +build !linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import "fmt"
+
+// Fanotify is only available on Linux.
+type Fanotify struct{}
+
+// FanotifyAvailable fanotify is not supported on this platform.
+func FanotifyAvailable() bool { return false }
+
+// NewFanotify fanotify is not supported on this platform.
+func NewFanotify(basePath string) (*Fanotify, error) {
+	return nil, fmt.Errorf("fanotify is not supported on this platform")
+}
+
+// Events Channel of decoded events.
+func (fn *Fanotify) Events() <-chan WatchEvent { return nil }
+
+// Errors Channel of errors from reading events.
+func (fn *Fanotify) Errors() <-chan error { return nil }
+
+// Add The whole filesystem is already watched.
+func (fn *Fanotify) Add(path string) error { return nil }
+
+// Remove The whole filesystem is watched, events are filtered by path.
+func (fn *Fanotify) Remove(path string) {}
+
+// Rename Paths are resolved per event, so there is nothing to update.
+func (fn *Fanotify) Rename(oldPath string, newPath string) {}
+
+// Close the fanotify instance.
+func (fn *Fanotify) Close() error { return nil }
@@ -27,6 +27,20 @@ type BlockMeta struct {
 
 	// Size of block.
 	Size int64
+
+	// Block lies entirely within a hole in a sparse file.
+	Hole bool
+}
+
+// Extent describes a byte range in a file.
+type Extent struct {
+	Offset int64
+	Size   int64
+}
+
+// Contains Check if the byte range [offset, offset+size) is within the extent.
+func (e Extent) Contains(offset int64, size int64) bool {
+	return offset >= e.Offset && offset+size <= e.Offset+e.Size
 }
 
 // FileMeta holds metadata about a file.
@@ -84,6 +98,12 @@ func ReadFile(filePath string, blockSize int64) (*FileMeta, error) {
 	f.CheckSum, _ = GetChecksum(filePath)
 	f.BlockSize = blockSize
 
+	holes, err := FindHoles(fh, f.Size)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("Error finding holes: %s", err.Error())
+	}
+
 	// Read chunks of blockSize until EOF.
 	for i := int64(0); i <= f.NumBlocks; i++ {
 		var offset int64 = 0
@@ -93,6 +113,26 @@ func ReadFile(filePath string, blockSize int64) (*FileMeta, error) {
 			offset = int64(i * blockSize)
 		}
 
+		// Blocks inside a hole read as zeroes, so there is no need to read them.
+		size := f.Size - offset
+		if size > blockSize {
+			size = blockSize
+		}
+
+		if size > 0 && isHole(holes, offset, size) {
+			md5Sum := md5.Sum(chunk)
+
+			f.Blocks = append(f.Blocks, BlockMeta{
+				Size:   size,
+				ChkSum: hex.EncodeToString(md5Sum[:16]),
+				Index:  i,
+				Offset: offset,
+				Hole:   true,
+			})
+
+			continue
+		}
+
 		nRead, err := fh.ReadAt(chunk, offset)
 
 		if err != nil && err != io.EOF {
@@ -118,6 +158,17 @@ func ReadFile(filePath string, blockSize int64) (*FileMeta, error) {
 	return &f, nil
 }
 
+// isHole Check if the given byte range is fully within one of holes.
+func isHole(holes []Extent, offset int64, size int64) bool {
+	for _, hole := range holes {
+		if hole.Contains(offset, size) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // GetBlockData Get data for given block number.
 func (f *FileMeta) GetBlockData(blockNumber int64) ([]byte, error) {
 	if f.Handle == nil {
@@ -168,7 +219,7 @@ func GetMissingBlocks(file1 *FileMeta, file2 *FileMeta) []int64 {
 	var missingBlocks []int64
 
 	// File2 (remote) is empty or non-existent, return all blocks.
-	if file2.Size == 0 || file2 == nil {
+	if file2 == nil || file2.Size == 0 {
 		for i := int64(0); i < file1.NumBlocks; i++ {
 			missingBlocks = append(missingBlocks, i)
 		}
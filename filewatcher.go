@@ -5,89 +5,390 @@ Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
 package main
 
 import (
-	"log"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WatchOp Type of change reported by a watch event.
+type WatchOp uint32
+
+const (
+	// WatchCreate A file or directory was created.
+	WatchCreate WatchOp = iota
+
+	// WatchWrite A file was written to.
+	WatchWrite
+
+	// WatchRemove A file or directory was removed.
+	WatchRemove
 
-	"github.com/fsnotify/fsnotify"
+	// WatchChmod Metadata of a file or directory changed.
+	WatchChmod
+
+	// WatchMovedFrom A file or directory was moved away from a watched directory.
+	WatchMovedFrom
+
+	// WatchMovedTo A file or directory was moved into a watched directory.
+	WatchMovedTo
+
+	// WatchOverflow Events were lost and the tree needs to be rescanned.
+	WatchOverflow
 )
 
-// FileWatcher monitors a directory for changes using inotify.
+// moveTimeout How long we wait for the IN_MOVED_TO matching an IN_MOVED_FROM
+// before treating it as a move out of the watched tree.
+const moveTimeout = 250 * time.Millisecond
+
+// rescanDelay Overflows tend to come in bursts, so we wait a little and
+// rescan once for all of them.
+const rescanDelay = 1 * time.Second
+
+// unwatchedRescanInterval How often we rescan while there are directories
+// we couldn't watch, and try to watch them again.
+const unwatchedRescanInterval = 1 * time.Minute
+
+// readRetryDelay How long an event source waits before reading again after
+// the given number of reads in a row failed. It doubles from 10ms up to 5s,
+// so an error that doesn't go away doesn't spin the CPU or flood Errors.
+func readRetryDelay(failures int) time.Duration {
+	delay := 10 * time.Millisecond
+	for i := 1; i < failures && delay < 5*time.Second; i++ {
+		delay *= 2
+	}
+
+	if delay > 5*time.Second {
+		delay = 5 * time.Second
+	}
+
+	return delay
+}
+
+// WatchEvent Represents a change to a file or directory.
+type WatchEvent struct {
+	Path string
+	Op   WatchOp
+
+	// Cookie ties the two halves of a move together.
+	Cookie uint32
+	IsDir  bool
+}
+
+// pendingMove A move we have seen the source of, but not the destination.
+type pendingMove struct {
+	event    WatchEvent
+	deadline time.Time
+}
+
+// eventSource A kernel notification API delivering WatchEvents.
+type eventSource interface {
+	Events() <-chan WatchEvent
+	Errors() <-chan error
+
+	// Add watch for a directory.
+	Add(path string) error
+
+	// Remove watches for path and everything below it.
+	Remove(path string)
+
+	// Rename Update watched paths after a directory has been moved.
+	Rename(oldPath string, newPath string)
+
+	Close() error
+}
+
+// FileWatcher monitors a directory for changes using inotify or fanotify.
 type FileWatcher struct {
-	watcher       *fsnotify.Watcher
-	tm            *TransferManager
-	previousEvent fsnotify.Event
+	watcher   eventSource
+	newSource func(basePath string) (eventSource, error)
+	tm        *TransferManager
+	moves     map[uint32]pendingMove
+	basePath  string
+	rescans   chan struct{}
+
+	// Compares the tree against the remote when events were lost.
+	reconciler   *Reconciler
+	reconcileMtx sync.Mutex
+
+	// Directories we ran out of watches for.
+	unwatched        map[string]bool
+	warnedWatchLimit bool
+}
+
+// NewFileWatcher Create new instance of FileWatcher using inotify. After
+// missed events the tree is compared by checksum if checksums is set.
+func NewFileWatcher(basePath string, transferManager *TransferManager, checksums bool) *FileWatcher {
+	return &FileWatcher{
+		newSource: func(basePath string) (eventSource, error) {
+			return NewInotify()
+		},
+		tm:         transferManager,
+		moves:      make(map[uint32]pendingMove),
+		basePath:   basePath,
+		rescans:    make(chan struct{}, 1),
+		reconciler: NewReconciler(transferManager, 0, checksums),
+		unwatched:  make(map[string]bool),
+	}
 }
 
-// NewFileWatcher Create new instance of FileWatcher.
-func NewFileWatcher(transferManager *TransferManager) *FileWatcher {
+// NewFanotifyWatcher Create new instance of FileWatcher using fanotify.
+func NewFanotifyWatcher(basePath string, transferManager *TransferManager, checksums bool) *FileWatcher {
 	return &FileWatcher{
-		tm: transferManager,
+		newSource: func(basePath string) (eventSource, error) {
+			return NewFanotify(basePath)
+		},
+		tm:         transferManager,
+		moves:      make(map[uint32]pendingMove),
+		basePath:   basePath,
+		rescans:    make(chan struct{}, 1),
+		reconciler: NewReconciler(transferManager, 0, checksums),
+		unwatched:  make(map[string]bool),
 	}
 }
 
 // handleWrite Handler for write event.
-func (fw *FileWatcher) handleWrite(event *fsnotify.Event) {
+func (fw *FileWatcher) handleWrite(event *WatchEvent) {
 	fw.tm.Add(QueueItem{
 		Action: TmActionWrite,
-		Path:   event.Name,
+		Path:   event.Path,
 	})
 }
 
 // handleCreate Handler for create event.
-func (fw *FileWatcher) handleCreate(event *fsnotify.Event) {
-	if IsDirectory(event.Name) {
-		fw.tm.Add(QueueItem{
-			Action: TmActionMkdir,
-			Path:   event.Name,
-			Mode:   GetFileMode(event.Name),
-		})
-		fw.watcher.Add(event.Name)
+func (fw *FileWatcher) handleCreate(event *WatchEvent) {
+	if IsDirectory(event.Path) {
+		fw.addDirectory(event.Path)
 	} else {
-
-		// RENAME is sent as two events, first RENAME then CREATE
-		// we handle this here.
-		if fw.previousEvent.Op == fsnotify.Rename {
-			fw.tm.Add(QueueItem{
-				Action:     TmActionRename,
-				Path:       fw.previousEvent.Name,
-				RenamePath: event.Name,
-			})
-			return
-		}
-
 		// File created.
 		fw.tm.Add(QueueItem{
 			Action: TmActionTouch,
-			Path:   event.Name,
+			Path:   event.Path,
 		})
 	}
 }
 
 // handleChmod Handler for chmod event.
-func (fw *FileWatcher) handleChmod(event *fsnotify.Event) {
-	fInfo, err := os.Stat(event.Name)
+func (fw *FileWatcher) handleChmod(event *WatchEvent) {
+	fInfo, err := os.Stat(event.Path)
 	if err != nil {
 		return
 	}
 
 	fw.tm.Add(QueueItem{
 		Action: TmActionChmod,
-		Path:   event.Name,
+		Path:   event.Path,
 		Mode:   uint32(fInfo.Mode()),
+		IsDir:  fInfo.IsDir(),
 	})
 }
 
 // handleRemove Handler for remove event.
-func (fw *FileWatcher) handleRemove(event *fsnotify.Event) {
+func (fw *FileWatcher) handleRemove(event *WatchEvent) {
 	fw.tm.Add(QueueItem{
 		Action: TmActionDelete,
-		Path:   event.Name,
+		Path:   event.Path,
+		IsDir:  event.IsDir,
 	})
 }
 
+// handleMovedFrom Handler for the first half of a move. We hold on to it
+// until the matching destination shows up or the move times out.
+func (fw *FileWatcher) handleMovedFrom(event *WatchEvent) {
+	fw.moves[event.Cookie] = pendingMove{
+		event:    *event,
+		deadline: time.Now().Add(moveTimeout),
+	}
+}
+
+// handleMovedTo Handler for the second half of a move.
+func (fw *FileWatcher) handleMovedTo(event *WatchEvent) {
+	move, ok := fw.moves[event.Cookie]
+
+	// Moved within the watched tree.
+	if ok {
+		delete(fw.moves, event.Cookie)
+
+		if event.IsDir {
+			fw.watcher.Rename(move.event.Path, event.Path)
+		}
+
+		fw.tm.Add(QueueItem{
+			Action:     TmActionRename,
+			Path:       move.event.Path,
+			RenamePath: event.Path,
+			IsDir:      event.IsDir,
+		})
+		return
+	}
+
+	// Moved in from outside the watched tree.
+	fw.expireMoves(true)
+	fw.addRecursive(event.Path)
+}
+
+// expireMoves Treat moves without a destination as moved out of the watched
+// tree, which on the remote is the same as a delete. The kernel queues both
+// halves of a move back to back, so once any other event arrives all pending
+// moves can be expired. Otherwise only those past their deadline are.
+func (fw *FileWatcher) expireMoves(all bool) {
+	now := time.Now()
+
+	for cookie, move := range fw.moves {
+		if !all && now.Before(move.deadline) {
+			continue
+		}
+
+		delete(fw.moves, cookie)
+
+		if move.event.IsDir {
+			fw.watcher.Remove(move.event.Path)
+		}
+
+		fw.handleRemove(&move.event)
+	}
+}
+
+// addRecursive Watch and queue a file or directory tree that appeared in
+// the watched tree.
+func (fw *FileWatcher) addRecursive(path string) {
+	if !IsDirectory(path) {
+		fw.handleWrite(&WatchEvent{Path: path, Op: WatchWrite})
+		return
+	}
+
+	fw.addDirectory(path)
+}
+
+// addDirectory Watch a directory and queue everything already in it. The
+// watch is added before the directory is read, so anything created in
+// between shows up either as an event or in the listing, never neither.
+func (fw *FileWatcher) addDirectory(path string) {
+	if fw.tm.Excluded(path, true) {
+		return
+	}
+
+	fw.tm.Add(QueueItem{
+		Action: TmActionMkdir,
+		Path:   path,
+		Mode:   GetFileMode(path),
+		IsDir:  true,
+	})
+
+	fw.addWatch(path)
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(path, entry.Name())
+
+		if entry.IsDir() {
+			fw.addDirectory(entryPath)
+		} else {
+			fw.handleWrite(&WatchEvent{Path: entryPath, Op: WatchWrite})
+		}
+	}
+}
+
+// addWatch Add a watch for a directory.
+func (fw *FileWatcher) addWatch(path string) {
+	err := fw.watcher.Add(path)
+	if err == nil {
+		delete(fw.unwatched, path)
+		return
+	}
+
+	if !IsWatchLimitError(err) {
+		fw.tm.Logger.Error("Failed to watch directory", Fields{"path": path, "error": err})
+		return
+	}
+
+	// Everything currently in the directory is still synced by the scan in
+	// addDirectory and initialSync, but later changes below it are only
+	// picked up by the rescans done while it is unwatched.
+	fw.unwatched[path] = true
+
+	if !fw.warnedWatchLimit {
+		fw.tm.Logger.Warn("inotify watch limit reached, changes below path are only detected by rescanning "+
+			"the tree every minute. Raise the limit with 'sysctl fs.inotify.max_user_watches=524288' and "+
+			"add it to /etc/sysctl.conf to make it permanent", Fields{"path": path})
+		fw.warnedWatchLimit = true
+	}
+}
+
+// rescan Watch every directory again and compare the tree against the
+// remote, after events were lost or directories couldn't be watched. Unlike
+// queueing the tree again, this also finds what was deleted or renamed
+// meanwhile.
+func (fw *FileWatcher) rescan() {
+	fw.unwatched = make(map[string]bool)
+
+	for _, dir := range ListDirectories(fw.basePath) {
+		if !fw.tm.Excluded(dir, true) {
+			fw.addWatch(filepath.Clean(dir))
+		}
+	}
+
+	// Listing both trees takes a while, events are handled meanwhile.
+	go fw.reconcile()
+}
+
+// reconcile Queue whatever is needed to make the remote match the tree.
+// Receivers that can't list their tree get the whole tree queued instead.
+func (fw *FileWatcher) reconcile() {
+	fw.reconcileMtx.Lock()
+	defer fw.reconcileMtx.Unlock()
+
+	fw.tm.Logger.Info("Rescanning", Fields{"path": fw.basePath})
+
+	if !fw.tm.sender.Capabilities().Has(FeatureListTree) {
+		fw.tm.AddTree(fw.basePath)
+		return
+	}
+
+	report, err := fw.reconciler.Run()
+	if err != nil {
+		fw.tm.Logger.Error("Rescan failed, queueing the whole tree instead", Fields{"path": fw.basePath, "error": err})
+		fw.tm.AddTree(fw.basePath)
+		return
+	}
+
+	fw.tm.Logger.Info("Rescan done", Fields{
+		"path":    fw.basePath,
+		"missing": report.Count(DriftMissing),
+		"changed": report.Count(DriftChanged),
+		"mode":    report.Count(DriftMode),
+		"renamed": report.Count(DriftRenamed),
+		"extra":   report.Count(DriftExtra),
+	})
+}
+
+// Rescan Compare the tree against the remote again and watch directories
+// that are no longer excluded. The rescan itself is done by the event loop.
+func (fw *FileWatcher) Rescan() {
+	select {
+	case fw.rescans <- struct{}{}:
+	default:
+	}
+}
+
+// Close stop watching.
+func (fw *FileWatcher) Close() error {
+	if fw.watcher == nil {
+		return nil
+	}
+
+	return fw.watcher.Close()
+}
+
 // Start watching files.
 func (fw *FileWatcher) Start() error {
-	watcher, err := fsnotify.NewWatcher()
+	basePath := fw.basePath
+	watcher, err := fw.newSource(basePath)
 
 	if err != nil {
 		return err
@@ -95,43 +396,75 @@ func (fw *FileWatcher) Start() error {
 
 	fw.watcher = watcher
 
-	basePath, err := os.Getwd()
-	if err != nil {
-		ExitIfError(err)
-	}
-
-	watcher.Add(basePath)
 	for _, dir := range ListDirectories(basePath) {
-		watcher.Add(dir)
+		if !fw.tm.Excluded(dir, true) {
+			fw.addWatch(filepath.Clean(dir))
+		}
 	}
 
 	go func() {
+		ticker := time.NewTicker(moveTimeout / 2)
+		defer ticker.Stop()
+
+		unwatchedTicker := time.NewTicker(unwatchedRescanInterval)
+		defer unwatchedTicker.Stop()
+
+		var rescan <-chan time.Time
+
 		for {
 			select {
-			case event, ok := <-watcher.Events:
+			case event, ok := <-watcher.Events():
 				if !ok {
 					return
 				}
 
+				if event.Op != WatchMovedTo {
+					fw.expireMoves(true)
+				}
+
 				switch event.Op {
-				case fsnotify.Write:
+				case WatchWrite:
 					fw.handleWrite(&event)
-				case fsnotify.Create:
+				case WatchCreate:
 					fw.handleCreate(&event)
-				case fsnotify.Remove:
+				case WatchRemove:
 					fw.handleRemove(&event)
-				case fsnotify.Chmod:
+				case WatchChmod:
 					fw.handleChmod(&event)
+				case WatchMovedFrom:
+					fw.handleMovedFrom(&event)
+				case WatchMovedTo:
+					fw.handleMovedTo(&event)
+				case WatchOverflow:
+					if rescan == nil {
+						fw.tm.Logger.Warn("Event queue overflowed, changes may have been missed. " +
+							"If this happens often, raise fs.inotify.max_queued_events with sysctl")
+						rescan = time.After(rescanDelay)
+					}
 				}
 
-				fw.previousEvent = event
+			case <-ticker.C:
+				fw.expireMoves(false)
+
+			case <-unwatchedTicker.C:
+				// Operations still in the queue would show up as drift.
+				if len(fw.unwatched) > 0 && fw.tm.Len() == 0 {
+					fw.rescan()
+				}
+
+			case <-rescan:
+				rescan = nil
+				fw.rescan()
+
+			case <-fw.rescans:
+				fw.rescan()
 
-			case err, ok := <-watcher.Errors:
+			case err, ok := <-watcher.Errors():
 				if !ok {
 					return
 				}
 
-				log.Printf("Error fsnotify: %s\n", err)
+				fw.tm.Logger.Error("Watch error", Fields{"path": basePath, "error": err})
 			}
 		}
 	}()
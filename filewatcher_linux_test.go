@@ -0,0 +1,146 @@
+//go:build linux
+// +build linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// startTestWatcher Watch dir, queueing on a transfer manager that is never
+// started so the queue can be inspected.
+func startTestWatcher(t *testing.T, dir string) (*FileWatcher, *TransferManager) {
+	return startTestWatcherWith(t, dir, NewSender())
+}
+
+// startTestWatcherWith Like startTestWatcher, with a sender of our own.
+func startTestWatcherWith(t *testing.T, dir string, sender *Sender) (*FileWatcher, *TransferManager) {
+	tm := NewTransferManager(sender, dir, nil, newJobMetrics("test"))
+	fw := NewFileWatcher(dir, tm, true)
+
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Start failed: %s", err)
+	}
+
+	t.Cleanup(func() { fw.watcher.Close() })
+
+	return fw, tm
+}
+
+func TestFileWatcherPairsMoves(t *testing.T) {
+	dir := testTree(t)
+	writeTestFile(t, filepath.Join(dir, "a"), "a")
+	writeTestFile(t, filepath.Join(dir, "c"), "c")
+
+	_, tm := startTestWatcher(t, dir)
+
+	// Two moves back to back must not be mixed up.
+	os.Rename(filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+	os.Rename(filepath.Join(dir, "c"), filepath.Join(dir, "d"))
+
+	for _, move := range [][2]string{{"a", "b"}, {"c", "d"}} {
+		from, to := move[0], move[1]
+		waitForItem(t, tm, "rename of "+from, func(item QueueItem) bool {
+			return item.Action == TmActionRename && item.Path == from && item.RenamePath == to
+		})
+	}
+
+	if queuedAction(tm, TmActionDelete, "a") || queuedAction(tm, TmActionDelete, "c") {
+		t.Errorf("A paired move was also queued as a delete")
+	}
+}
+
+func TestFileWatcherMoveOutIsDelete(t *testing.T) {
+	outside := t.TempDir()
+	dir := testTree(t)
+	writeTestFile(t, filepath.Join(dir, "a"), "a")
+
+	_, tm := startTestWatcher(t, dir)
+	os.Rename(filepath.Join(dir, "a"), filepath.Join(outside, "a"))
+
+	waitForItem(t, tm, "delete", func(item QueueItem) bool {
+		return item.Action == TmActionDelete && item.Path == "a"
+	})
+}
+
+func TestFileWatcherMoveInIsAdded(t *testing.T) {
+	outside := t.TempDir()
+	dir := testTree(t)
+	writeTestFile(t, filepath.Join(outside, "sub", "deeper", "f"), "f")
+
+	_, tm := startTestWatcher(t, dir)
+	os.Rename(filepath.Join(outside, "sub"), filepath.Join(dir, "sub"))
+
+	for _, path := range []string{"sub", "sub/deeper"} {
+		path := path
+		waitForItem(t, tm, "mkdir of "+path, func(item QueueItem) bool {
+			return item.Action == TmActionMkdir && item.Path == path
+		})
+	}
+
+	waitForItem(t, tm, "write", func(item QueueItem) bool {
+		return item.Action == TmActionWrite && item.Path == "sub/deeper/f"
+	})
+
+	// The directory moved in is watched as well.
+	writeTestFile(t, filepath.Join(dir, "sub", "deeper", "g"), "g")
+	waitForItem(t, tm, "touch of the new file", func(item QueueItem) bool {
+		return item.Action == TmActionTouch && item.Path == "sub/deeper/g"
+	})
+}
+
+func TestFileWatcherRenamedDirectoryKeepsWatches(t *testing.T) {
+	dir := testTree(t)
+	if err := os.MkdirAll(filepath.Join(dir, "old", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, tm := startTestWatcher(t, dir)
+	os.Rename(filepath.Join(dir, "old"), filepath.Join(dir, "new"))
+
+	waitForItem(t, tm, "rename", func(item QueueItem) bool {
+		return item.Action == TmActionRename && item.Path == "old" && item.RenamePath == "new"
+	})
+
+	// Events below the renamed directory carry the new name.
+	writeTestFile(t, filepath.Join(dir, "new", "sub", "f"), "f")
+	waitForItem(t, tm, "touch below the renamed directory", func(item QueueItem) bool {
+		return item.Action == TmActionTouch && item.Path == "new/sub/f"
+	})
+}
+
+func TestFileWatcherOverflowReconciles(t *testing.T) {
+	dir := testTree(t)
+	writeTestFile(t, filepath.Join(dir, "kept"), "k")
+	writeTestFile(t, filepath.Join(dir, "new"), "n")
+
+	sender := connectTestReceiver(t, &testReceiver{
+		tree: []*TreeEntry{
+			{Path: "kept", Size: 1, Mode: 0644},
+			{Path: "gone", Size: 1, Mode: 0644},
+		},
+	})
+
+	fw, tm := startTestWatcherWith(t, dir, sender)
+
+	// What the reader sends when the kernel reports IN_Q_OVERFLOW.
+	fw.watcher.(*Inotify).events <- WatchEvent{Op: WatchOverflow}
+
+	waitForItem(t, tm, "delete of the path we missed", func(item QueueItem) bool {
+		return item.Action == TmActionDelete && item.Path == "gone"
+	})
+
+	waitForItem(t, tm, "write of the missing file", func(item QueueItem) bool {
+		return item.Action == TmActionWrite && item.Path == "new"
+	})
+
+	if queuedAction(tm, TmActionWrite, "kept") {
+		t.Errorf("A file that matches the receiver was queued")
+	}
+}
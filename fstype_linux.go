@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Filesystems where changes can be made without the local kernel knowing,
+// so inotify won't see them. Values are the f_type magic numbers from statfs(2).
+var remoteFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xfe534d42: "smb2",
+	0xff534d42: "cifs",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x0bd00bd0: "lustre",
+	0x47504653: "gpfs",
+	0x00c36400: "ceph",
+	0x013111a8: "ibrix",
+	0x564c:     "ncp",
+	0x7461636f: "ocfs2",
+}
+
+// FileOwner User id of the owner of a file.
+func FileOwner(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return int(stat.Uid), true
+}
+
+// IsRemoteFilesystem Check if path is on a network or FUSE filesystem.
+func IsRemoteFilesystem(path string) (string, bool) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", false
+	}
+
+	fsType, ok := remoteFilesystems[uint32(stat.Type)]
+	return fsType, ok
+}
+
+// FreeSpace Get the bytes available to unprivileged users on the filesystem
+// of path.
+func FreeSpace(path string) (int64, bool) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, false
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), true
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import "os"
+
+// IsRemoteFilesystem Filesystem detection is only supported on Linux.
+func IsRemoteFilesystem(path string) (string, bool) {
+	return "", false
+}
+
+// FileOwner File ownership is only checked on Linux.
+func FileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
+
+// FreeSpace Free space detection is only supported on Linux.
+func FreeSpace(path string) (int64, bool) {
+	return 0, false
+}
@@ -5,7 +5,10 @@ go 1.15
 require (
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/golang/protobuf v1.4.3
+	github.com/prometheus/client_golang v1.9.0
 	github.com/stretchr/testify v1.5.1
+	golang.org/x/sys v0.0.0-20201214210602-f9fddec55a1e
 	google.golang.org/grpc v1.34.0
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,76 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// receiverServiceName Name of the receiver service in health checks.
+const receiverServiceName = "main.ReceiverService"
+
+// checkTarget Check that files can be written to the target directory, our
+// working directory. Returns why not if they can't. The probe is written with
+// the partial transfers so it never shows up in the synced tree.
+func checkTarget(minFree int64) error {
+	err := os.MkdirAll(partialDir, 0700)
+	if err != nil {
+		return fmt.Errorf("Target directory is not writable: %s", err.Error())
+	}
+
+	fh, err := ioutil.TempFile(partialDir, "health-")
+	if err != nil {
+		return fmt.Errorf("Target directory is not writable: %s", err.Error())
+	}
+
+	fh.Close()
+	os.Remove(fh.Name())
+
+	if free, ok := FreeSpace("."); ok && free <= minFree {
+		return fmt.Errorf("Target filesystem is full, %d bytes free", free)
+	}
+
+	return nil
+}
+
+// watchHealth Check the target directory every interval and report the
+// result to the health service, until done is closed.
+func (r *Receiver) watchHealth(interval time.Duration, done chan struct{}) {
+	var lastErr error
+	healthy := true
+
+	for {
+		err := checkTarget(r.MinFreeSpace)
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		r.health.SetServingStatus("", status)
+		r.health.SetServingStatus(receiverServiceName, status)
+
+		switch {
+		case err != nil && (healthy || err.Error() != lastErr.Error()):
+			logger.Warn("Not serving", Fields{"error": err})
+		case err == nil && !healthy:
+			logger.Info("Serving again")
+		}
+
+		healthy = err == nil
+		lastErr = err
+
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
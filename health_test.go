@@ -0,0 +1,37 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCheckTarget(t *testing.T) {
+	enterTestTree(t)
+
+	if err := checkTarget(0); err != nil {
+		t.Fatalf("checkTarget failed: %s", err)
+	}
+
+	// The probe is kept out of the synced tree, and removed.
+	files, _ := ioutil.ReadDir(".")
+	if len(files) != 1 || files[0].Name() != partialDir {
+		t.Errorf("checkTarget left %d files in the tree", len(files))
+	}
+
+	if probes, _ := ioutil.ReadDir(partialDir); len(probes) != 0 {
+		t.Errorf("checkTarget left %d files in %s", len(probes), partialDir)
+	}
+
+	if _, ok := FreeSpace("."); !ok {
+		t.Skip("Free space can't be checked on this platform")
+	}
+
+	if err := checkTarget(1 << 62); err == nil || !strings.Contains(err.Error(), "full") {
+		t.Errorf("checkTarget = %v, want the filesystem to be full", err)
+	}
+}
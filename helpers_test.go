@@ -0,0 +1,162 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// testTree Create a directory to sync. Symlinks are resolved since the
+// watchers report paths below the real directory.
+func testTree(t *testing.T) string {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+// enterTestTree Create a directory and make it the working directory, which
+// the receiver takes paths relative to.
+func enterTestTree(t *testing.T) string {
+	dir := testTree(t)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	return dir
+}
+
+// writeTestFile Create a file with content, and the directories it is in.
+func writeTestFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForItem Wait until an item matching match is queued.
+func waitForItem(t *testing.T, tm *TransferManager, what string, match func(item QueueItem) bool) QueueItem {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		tm.mtx.Lock()
+		queue := append([]QueueItem(nil), tm.queue...)
+		tm.mtx.Unlock()
+
+		for _, item := range queue {
+			if match(item) {
+				return item
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	t.Fatalf("No %s was queued, queue is %+v", what, tm.queue)
+
+	return QueueItem{}
+}
+
+// queuedAction Check if an item with action for path is queued.
+func queuedAction(tm *TransferManager, action uint, path string) bool {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	for _, item := range tm.queue {
+		if item.Action == action && item.Path == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// testReceiver A receiver that only answers the read-only RPCs. The tree is
+// read from root if set, otherwise the fixed tree is sent.
+type testReceiver struct {
+	UnimplementedReceiverServiceServer
+	tree []*TreeEntry
+	root string
+}
+
+// Hello Answer the handshake like a current receiver.
+func (r *testReceiver) Hello(ctx context.Context, req *HelloRequest) (*HelloResponse, error) {
+	return NewReceiver().Hello(ctx, req)
+}
+
+// ListTree Send the tree.
+func (r *testReceiver) ListTree(req *ListTreeRequest, stream ReceiverService_ListTreeServer) error {
+	tree := r.tree
+	if r.root != "" {
+		var err error
+		if tree, err = ListTree(r.root, req.GetWithChecksums()); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range tree {
+		if err := stream.Send(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetFileChecksum Checksum of a file below root.
+func (r *testReceiver) GetFileChecksum(ctx context.Context, req *FileRequest) (*FileChecksumResponse, error) {
+	return NewReceiver().GetFileChecksum(ctx, &FileRequest{Path: filepath.Join(r.root, req.GetPath())})
+}
+
+// GetFileMeta Block metadata of a file below root.
+func (r *testReceiver) GetFileMeta(ctx context.Context, req *FileRequest) (*FileResponse, error) {
+	return NewReceiver().GetFileMeta(ctx, &FileRequest{
+		Path:      filepath.Join(r.root, req.GetPath()),
+		BlockSize: req.GetBlockSize(),
+	})
+}
+
+// connectTestReceiver Serve receiver on a free port and connect a sender to it.
+func connectTestReceiver(t *testing.T, receiver ReceiverServiceServer) *Sender {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	RegisterReceiverServiceServer(server, receiver)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	sender := NewSender()
+	if err := sender.Connect(listener.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	return sender
+}
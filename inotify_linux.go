@@ -0,0 +1,231 @@
+//go:build linux
+// +build linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DONT_FOLLOW
+
+// Inotify is a thin wrapper around the Linux inotify API. Unlike fsnotify it
+// exposes the cookie that ties IN_MOVED_FROM and IN_MOVED_TO together.
+type Inotify struct {
+	events chan WatchEvent
+	errors chan error
+
+	fd    int
+	fh    *os.File
+	mtx   sync.Mutex
+	paths map[int]string
+	wds   map[string]int
+}
+
+// NewInotify Create new inotify instance and start reading events.
+func NewInotify() (*Inotify, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %s", err.Error())
+	}
+
+	in := &Inotify{
+		events: make(chan WatchEvent),
+		errors: make(chan error),
+		fd:     fd,
+		fh:     os.NewFile(uintptr(fd), "inotify"),
+		paths:  make(map[int]string),
+		wds:    make(map[string]int),
+	}
+
+	go in.readEvents()
+
+	return in, nil
+}
+
+// InotifyAvailable Check if we are able to create an inotify instance.
+func InotifyAvailable() bool {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return false
+	}
+
+	syscall.Close(fd)
+	return true
+}
+
+// Events Channel of decoded events.
+func (in *Inotify) Events() <-chan WatchEvent {
+	return in.events
+}
+
+// Errors Channel of errors from reading events.
+func (in *Inotify) Errors() <-chan error {
+	return in.errors
+}
+
+// Add watch for a directory.
+func (in *Inotify) Add(path string) error {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+
+	wd, err := syscall.InotifyAddWatch(in.fd, path, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+
+	in.paths[wd] = path
+	in.wds[path] = wd
+
+	return nil
+}
+
+// Remove watches for path and everything below it.
+func (in *Inotify) Remove(path string) {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+
+	for watchPath, wd := range in.wds {
+		if watchPath == path || strings.HasPrefix(watchPath, path+"/") {
+			syscall.InotifyRmWatch(in.fd, uint32(wd))
+			delete(in.wds, watchPath)
+			delete(in.paths, wd)
+		}
+	}
+}
+
+// Rename Update watched paths after a directory has been moved. The kernel
+// keeps the watches since they follow the inode, we only track the new name.
+func (in *Inotify) Rename(oldPath string, newPath string) {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+
+	for watchPath, wd := range in.wds {
+		if watchPath == oldPath || strings.HasPrefix(watchPath, oldPath+"/") {
+			renamed := newPath + strings.TrimPrefix(watchPath, oldPath)
+			delete(in.wds, watchPath)
+			in.wds[renamed] = wd
+			in.paths[wd] = renamed
+		}
+	}
+}
+
+// IsWatchLimitError Check if err means we ran out of inotify watches.
+func IsWatchLimitError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// InotifyWatchLimit Get the number of inotify watches a user can have, from
+// fs.inotify.max_user_watches. Returns false if it can't be read.
+func InotifyWatchLimit() (int, bool) {
+	data, err := ioutil.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0, false
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+
+	return limit, true
+}
+
+// Close the inotify instance, this will also stop the reader.
+func (in *Inotify) Close() error {
+	return in.fh.Close()
+}
+
+// readEvents Read and decode events until the inotify instance is closed.
+func (in *Inotify) readEvents() {
+	defer close(in.events)
+	defer close(in.errors)
+
+	var buf [syscall.SizeofInotifyEvent * 4096]byte
+	failures := 0
+
+	for {
+		n, err := in.fh.Read(buf[:])
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+
+			failures++
+			in.errors <- err
+			time.Sleep(readRetryDelay(failures))
+			continue
+		}
+
+		failures = 0
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			name := strings.TrimRight(string(nameBytes), "\x00")
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			// Events were dropped by the kernel, we don't know what changed.
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				in.events <- WatchEvent{Op: WatchOverflow}
+				continue
+			}
+
+			in.mtx.Lock()
+			dir, ok := in.paths[int(raw.Wd)]
+
+			// The watch is gone when the directory is deleted or unmounted.
+			if raw.Mask&syscall.IN_IGNORED != 0 {
+				delete(in.paths, int(raw.Wd))
+				if in.wds[dir] == int(raw.Wd) {
+					delete(in.wds, dir)
+				}
+			}
+			in.mtx.Unlock()
+
+			if !ok || name == "" {
+				continue
+			}
+
+			event := WatchEvent{
+				Path:   filepath.Join(dir, name),
+				Cookie: raw.Cookie,
+				IsDir:  raw.Mask&syscall.IN_ISDIR != 0,
+			}
+
+			switch {
+			case raw.Mask&syscall.IN_CREATE != 0:
+				event.Op = WatchCreate
+			case raw.Mask&syscall.IN_MODIFY != 0:
+				event.Op = WatchWrite
+			case raw.Mask&syscall.IN_ATTRIB != 0:
+				event.Op = WatchChmod
+			case raw.Mask&syscall.IN_DELETE != 0:
+				event.Op = WatchRemove
+			case raw.Mask&syscall.IN_MOVED_FROM != 0:
+				event.Op = WatchMovedFrom
+			case raw.Mask&syscall.IN_MOVED_TO != 0:
+				event.Op = WatchMovedTo
+			default:
+				continue
+			}
+
+			in.events <- event
+		}
+	}
+}
@@ -0,0 +1,161 @@
+//go:build !linux
+// +build !linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Inotify Watches directories with fsnotify where there is no inotify.
+// fsnotify doesn't tell which events belong to the same move, so a move is
+// seen as a remove of the old path and a create of the new one.
+type Inotify struct {
+	events chan WatchEvent
+	errors chan error
+
+	watcher *fsnotify.Watcher
+	mtx     sync.Mutex
+	paths   map[string]bool
+}
+
+// NewInotify Create new watcher and start reading events.
+func NewInotify() (*Inotify, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	in := &Inotify{
+		events:  make(chan WatchEvent),
+		errors:  make(chan error),
+		watcher: watcher,
+		paths:   make(map[string]bool),
+	}
+
+	go in.readEvents()
+
+	return in, nil
+}
+
+// InotifyAvailable Check if we are able to create an fsnotify watcher.
+func InotifyAvailable() bool {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return false
+	}
+
+	watcher.Close()
+	return true
+}
+
+// Events Channel of translated events.
+func (in *Inotify) Events() <-chan WatchEvent { return in.events }
+
+// Errors Channel of errors from fsnotify.
+func (in *Inotify) Errors() <-chan error { return in.errors }
+
+// Add watch for a directory.
+func (in *Inotify) Add(path string) error {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+
+	err := in.watcher.Add(path)
+	if err != nil {
+		return err
+	}
+
+	in.paths[path] = true
+
+	return nil
+}
+
+// Remove watches for path and everything below it.
+func (in *Inotify) Remove(path string) {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+
+	for watchPath := range in.paths {
+		if watchPath == path || strings.HasPrefix(watchPath, path+"/") {
+			in.watcher.Remove(watchPath)
+			delete(in.paths, watchPath)
+		}
+	}
+}
+
+// watched Check if path is a watched directory.
+func (in *Inotify) watched(path string) bool {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+
+	return in.paths[path]
+}
+
+// Rename Moves are seen as a remove and a create, so there is nothing to
+// update.
+func (in *Inotify) Rename(oldPath string, newPath string) {}
+
+// IsWatchLimitError Only inotify has a watch limit.
+func IsWatchLimitError(err error) bool { return false }
+
+// InotifyWatchLimit Only inotify has a watch limit.
+func InotifyWatchLimit() (int, bool) { return 0, false }
+
+// Close the watcher, this will also stop the reader.
+func (in *Inotify) Close() error {
+	return in.watcher.Close()
+}
+
+// readEvents Translate events from fsnotify until it is closed.
+func (in *Inotify) readEvents() {
+	defer close(in.events)
+	defer close(in.errors)
+
+	for {
+		select {
+		case fsEvent, ok := <-in.watcher.Events:
+			if !ok {
+				return
+			}
+
+			event := WatchEvent{
+				Path: fsEvent.Name,
+			}
+
+			switch {
+			case fsEvent.Op&fsnotify.Create != 0:
+				event.Op = WatchCreate
+				event.IsDir = IsDirectory(fsEvent.Name)
+			case fsEvent.Op&fsnotify.Write != 0:
+				event.Op = WatchWrite
+			case fsEvent.Op&fsnotify.Chmod != 0:
+				event.Op = WatchChmod
+			case fsEvent.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				// The path is gone, but the directories are the ones we
+				// watch. A renamed directory is still watched under its
+				// old name.
+				event.Op = WatchRemove
+				event.IsDir = in.watched(fsEvent.Name)
+				in.Remove(fsEvent.Name)
+			default:
+				continue
+			}
+
+			in.events <- event
+
+		case err, ok := <-in.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			in.errors <- err
+		}
+	}
+}
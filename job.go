@@ -0,0 +1,445 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job A local directory kept in sync with a receiver. Every job has its own
+// connection, watcher and transfer queue, so jobs run independently.
+type Job struct {
+	config     JobConfig
+	exclude    *ExcludeFilter
+	limiter    *BandwidthLimiter
+	sender     *Sender
+	tm         *TransferManager
+	watcher    Watcher
+	reconciler *Reconciler
+	logger     *Logger
+}
+
+// NewJob Create new instance of Job and connect to its receiver. The config
+// has to be validated first.
+func NewJob(config JobConfig, logger *Logger) (*Job, error) {
+	exclude, err := NewExcludeFilter(config.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := newJobMetrics(config.Name)
+	limiter := NewBandwidthLimiter(config.BandwidthLimit, config.BandwidthSchedule)
+
+	sender := NewSender()
+	sender.BlockSize = config.BlockSize
+	sender.BasePath = config.Path
+	sender.Limiter = limiter
+	sender.Verify = config.Verify
+	sender.OnVerifyFailure = metrics.verifyFailures.Inc
+	sender.OnReconnect = metrics.reconnects.Inc
+	sender.Timeouts = RPCTimeouts{
+		Default:  config.RPCTimeout,
+		Block:    config.BlockTimeout,
+		Checksum: config.ChecksumTimeout,
+		ListTree: config.ListTimeout,
+	}
+
+	logger.Info("Connecting", Fields{"remote": config.Remote})
+	err = sender.Connect(config.Remote)
+	if err != nil {
+		return nil, err
+	}
+
+	tm := NewTransferManager(sender, config.Path, exclude, metrics)
+	tm.Logger = logger
+	tm.RetryPolicy.MaxRetries = config.MaxRetries
+
+	return &Job{
+		config:  config,
+		exclude: exclude,
+		limiter: limiter,
+		sender:  sender,
+		tm:      tm,
+		logger:  logger,
+	}, nil
+}
+
+// Name of the job.
+func (j *Job) Name() string {
+	return j.config.Name
+}
+
+// Start Sync the directory and keep it in sync as files change, until Stop
+// is called.
+func (j *Job) Start() error {
+	fileWatcher, err := NewWatcher(j.config.Watcher, j.config.Path, j.tm, j.config.PollInterval, j.config.ReconcileChecksums)
+	if err != nil {
+		return err
+	}
+
+	err = fileWatcher.Start()
+	if err != nil {
+		return fmt.Errorf("Failed to watch %s: %s", j.config.Path, err.Error())
+	}
+
+	j.watcher = fileWatcher
+
+	// The watcher is started first so nothing changed while we sync what
+	// is there now is missed.
+	j.tm.AddTree(j.config.Path)
+
+	if j.config.ReconcileInterval > 0 {
+		j.reconciler = NewReconciler(j.tm, j.config.ReconcileInterval, j.config.ReconcileChecksums)
+		j.reconciler.Start()
+	}
+
+	go j.tm.Start()
+
+	return nil
+}
+
+// Stop watching, wait for the file being transferred and close the
+// connection to the receiver. A transfer taking longer than timeout is
+// cancelled, the file is then synced again on the next start.
+func (j *Job) Stop(timeout time.Duration) {
+	if j.watcher != nil {
+		j.watcher.Close()
+	}
+
+	if j.reconciler != nil {
+		j.reconciler.Stop()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		j.tm.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		j.logger.Warn("Transfer still running, cancelling it", Fields{"timeout": timeout})
+		j.sender.Cancel()
+		<-stopped
+	}
+
+	j.sender.Close()
+	j.tm.metrics.remove()
+}
+
+// SetExclude Change the exclude patterns of a running job. The tree is
+// rescanned, so paths that are no longer excluded get synced. Paths that are
+// excluded now are left on the receiver.
+func (j *Job) SetExclude(patterns []string) error {
+	exclude, err := NewExcludeFilter(patterns)
+	if err != nil {
+		return err
+	}
+
+	j.config.Exclude = patterns
+	j.exclude = exclude
+	j.tm.SetExclude(exclude)
+	j.watcher.Rescan()
+
+	return nil
+}
+
+// Progress Get how far the job has come with syncing the queued changes.
+func (j *Job) Progress() QueueProgress {
+	return j.tm.Progress()
+}
+
+// SetBandwidth Change the bandwidth limit and schedule of a running job. A
+// limit set with the bwlimit command stays in place.
+func (j *Job) SetBandwidth(limit ByteRate, schedule BandwidthSchedule) {
+	j.config.BandwidthLimit = limit
+	j.config.BandwidthSchedule = schedule
+	j.limiter.SetLimits(limit, schedule)
+}
+
+// Limiter Get the bandwidth limiter of the job.
+func (j *Job) Limiter() *BandwidthLimiter {
+	return j.limiter
+}
+
+// BandwidthStatus Get the bandwidth limits of the job.
+func (j *Job) BandwidthStatus() BandwidthStatus {
+	_, override := j.limiter.Override()
+
+	status := BandwidthStatus{
+		Job:      j.Name(),
+		Limit:    j.limiter.Limit(),
+		Override: override,
+		Default:  j.config.BandwidthLimit,
+		Schedule: []string{},
+	}
+
+	for _, entry := range j.config.BandwidthSchedule {
+		status.Schedule = append(status.Schedule, entry.String())
+	}
+
+	return status
+}
+
+// Status Get the state of the job for the status command.
+func (j *Job) Status() JobStatus {
+	tmStatus := j.tm.Status(statusQueueItems)
+	caps := j.sender.Capabilities()
+
+	status := JobStatus{
+		Name:         j.config.Name,
+		Path:         j.config.Path,
+		Remote:       j.config.Remote,
+		Connection:   j.sender.State(),
+		Bandwidth:    j.limiter.Limit(),
+		Receiver:     caps.Version,
+		Protocol:     caps.ProtocolVersion,
+		QueueLength:  tmStatus.QueueLength,
+		Queue:        []QueueEntry{},
+		Processed:    tmStatus.Summary.Processed,
+		Failed:       len(tmStatus.Summary.Failed),
+		BytesSent:    tmStatus.BytesSent,
+		BytesSkipped: tmStatus.BytesSkipped,
+		RecentErrors: []ErrorStatus{},
+	}
+
+	for _, item := range tmStatus.Queued {
+		status.Queue = append(status.Queue, newQueueEntry(item))
+	}
+
+	if tmStatus.InFlight != nil {
+		status.InFlight = &InFlightStatus{QueueEntry: newQueueEntry(*tmStatus.InFlight)}
+
+		if current := tmStatus.Progress.Current; current != nil {
+			status.InFlight.BlocksDone = current.BlocksDone
+			status.InFlight.BlocksTotal = current.BlocksTotal
+			status.InFlight.BytesDone = current.BytesDone
+			status.InFlight.BytesTotal = current.BytesTotal
+			status.InFlight.Started = &current.Started
+		}
+	}
+
+	for _, recent := range tmStatus.Recent {
+		status.RecentErrors = append(status.RecentErrors, newErrorStatus(recent))
+	}
+
+	return status
+}
+
+// Failed Get the items of the job that failed for good.
+func (j *Job) Failed() FailedStatus {
+	status := FailedStatus{
+		Job:   j.config.Name,
+		Items: []ErrorStatus{},
+	}
+
+	for _, failed := range j.tm.Failed() {
+		status.Items = append(status.Items, newErrorStatus(failed))
+	}
+
+	return status
+}
+
+// Retry Queue the failed items with one of paths again, or all of them if
+// paths is empty. Paths can be relative to the directory of the job or
+// absolute.
+func (j *Job) Retry(paths []string) FailedStatus {
+	var relPaths []string
+
+	for _, path := range paths {
+		if filepath.IsAbs(path) {
+			if relPath, err := StripBasepath(j.config.Path, path); err == nil {
+				path = relPath
+			}
+		}
+
+		relPaths = append(relPaths, filepath.Clean(path))
+	}
+
+	status := FailedStatus{
+		Job:   j.config.Name,
+		Items: []ErrorStatus{},
+	}
+
+	for _, retried := range j.tm.Retry(relPaths) {
+		status.Items = append(status.Items, newErrorStatus(retried))
+	}
+
+	if len(status.Items) > 0 {
+		j.logger.Info("Retrying failed items", Fields{"items": len(status.Items)})
+	}
+
+	return status
+}
+
+// RunOnce Sync the directory once and return what was done.
+func (j *Job) RunOnce() TransferSummary {
+	j.tm.AddTree(j.config.Path)
+	j.tm.Drain()
+
+	return j.tm.Summary()
+}
+
+// DryRun Print what a sync of the directory would change.
+func (j *Job) DryRun(out io.Writer) error {
+	return DryRun(j.sender, j.exclude, out)
+}
+
+// Verify Compare the directory to the receiver and report every difference.
+func (j *Job) Verify(checksums bool) (*VerifyReport, error) {
+	report, err := Verify(j.sender, j.exclude, checksums)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Job = j.config.Name
+	report.Remote = j.config.Remote
+
+	return report, nil
+}
+
+// JobRunner Runs a set of jobs and applies changes in their configuration.
+type JobRunner struct {
+	jobs        map[string]*Job
+	stopTimeout time.Duration
+	mtx         sync.Mutex
+}
+
+// NewJobRunner Create new instance of JobRunner. Stopping jobs is given
+// stopTimeout to finish the file being transferred.
+func NewJobRunner(stopTimeout time.Duration) *JobRunner {
+	return &JobRunner{
+		jobs:        make(map[string]*Job),
+		stopTimeout: stopTimeout,
+	}
+}
+
+// Apply Make the running jobs match configs. Jobs are matched by name, those
+// no longer in configs are stopped and new ones started. A job where only the
+// excludes or bandwidth limits changed keeps running with the new ones, other
+// changes restart it. Jobs that fail to start are reported but don't stop the
+// others.
+func (jr *JobRunner) Apply(configs []JobConfig) error {
+	jr.mtx.Lock()
+	defer jr.mtx.Unlock()
+
+	var errs []string
+	wanted := make(map[string]bool)
+
+	for _, config := range configs {
+		wanted[config.Name] = true
+	}
+
+	for name, job := range jr.jobs {
+		if !wanted[name] {
+			job.logger.Info("Stopping job, it was removed from the config")
+			job.Stop(jr.stopTimeout)
+			delete(jr.jobs, name)
+		}
+	}
+
+	for _, config := range configs {
+		job, ok := jr.jobs[config.Name]
+
+		if ok {
+			if reflect.DeepEqual(job.config, config) {
+				continue
+			}
+
+			// Only options that can be changed while running changed.
+			live := job.config
+			live.Exclude = config.Exclude
+			live.BandwidthLimit = config.BandwidthLimit
+			live.BandwidthSchedule = config.BandwidthSchedule
+
+			if reflect.DeepEqual(live, config) {
+				if !reflect.DeepEqual(job.config.Exclude, config.Exclude) {
+					job.logger.Info("Excludes changed, rescanning")
+					if err := job.SetExclude(config.Exclude); err != nil {
+						errs = append(errs, fmt.Sprintf("job '%s': %s", config.Name, err.Error()))
+					}
+				}
+
+				if job.config.BandwidthLimit != config.BandwidthLimit ||
+					!reflect.DeepEqual(job.config.BandwidthSchedule, config.BandwidthSchedule) {
+					job.SetBandwidth(config.BandwidthLimit, config.BandwidthSchedule)
+					job.logger.Info("Bandwidth limits changed", Fields{"bwlimit": job.limiter.Limit()})
+				}
+
+				continue
+			}
+
+			job.logger.Info("Restarting job, its config changed")
+			job.Stop(jr.stopTimeout)
+			delete(jr.jobs, config.Name)
+		}
+
+		job, err := NewJob(config, logger.With(Fields{"job": config.Name}))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("job '%s': %s", config.Name, err.Error()))
+			continue
+		}
+
+		err = job.Start()
+		if err != nil {
+			job.sender.Close()
+			errs = append(errs, fmt.Sprintf("job '%s': %s", config.Name, err.Error()))
+			continue
+		}
+
+		jr.jobs[config.Name] = job
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Failed to start jobs:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+
+	return nil
+}
+
+// Jobs Get the running jobs, ordered by name.
+func (jr *JobRunner) Jobs() []*Job {
+	jr.mtx.Lock()
+	defer jr.mtx.Unlock()
+
+	jobs := make([]*Job, 0, len(jr.jobs))
+	for _, job := range jr.jobs {
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Name() < jobs[k].Name()
+	})
+
+	return jobs
+}
+
+// Stop all jobs.
+func (jr *JobRunner) Stop() {
+	jr.mtx.Lock()
+	defer jr.mtx.Unlock()
+
+	var wg sync.WaitGroup
+
+	for name, job := range jr.jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			job.Stop(jr.stopTimeout)
+		}(job)
+
+		delete(jr.jobs, name)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,240 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel Severity of a log entry.
+type LogLevel int
+
+const (
+	// LevelDebug Details only useful when looking into a problem.
+	LevelDebug LogLevel = iota
+
+	// LevelInfo Normal operation, like files being transferred.
+	LevelInfo
+
+	// LevelWarn Something is wrong, but we carry on.
+	LevelWarn
+
+	// LevelError An operation failed.
+	LevelError
+)
+
+const (
+	// LogFormatText Human readable log lines with fields as key=value.
+	LogFormatText = "text"
+
+	// LogFormatJSON One JSON object per line.
+	LogFormatJSON = "json"
+)
+
+// levelNames Names of the levels as shown in logs and accepted by -log-level.
+var levelNames = map[LogLevel]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// String Name of the level.
+func (l LogLevel) String() string {
+	return levelNames[l]
+}
+
+// ParseLogLevel Get the level with the given name.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("Unknown log level '%s', supported levels are debug, info, warn and error", name)
+}
+
+// Fields Key/value pairs attached to a log entry, like path, action, bytes,
+// duration, error and peer.
+type Fields map[string]interface{}
+
+// logOutput Where log entries go, shared by a logger and those derived from it.
+type logOutput struct {
+	out    io.Writer
+	level  LogLevel
+	format string
+	mtx    sync.Mutex
+}
+
+// Logger Writes leveled log entries with fields, as text or JSON.
+type Logger struct {
+	output *logOutput
+	fields Fields
+}
+
+// logger The logger used unless a more specific one is passed around.
+var logger = NewLogger(os.Stderr, LevelInfo, LogFormatText)
+
+// NewLogger Create new instance of Logger.
+func NewLogger(out io.Writer, level LogLevel, format string) *Logger {
+	return &Logger{
+		output: &logOutput{
+			out:    out,
+			level:  level,
+			format: format,
+		},
+	}
+}
+
+// SetLevel Only write entries of level and above. Affects derived loggers too.
+func (l *Logger) SetLevel(level LogLevel) {
+	l.output.mtx.Lock()
+	l.output.level = level
+	l.output.mtx.Unlock()
+}
+
+// SetFormat Write entries as text or JSON. Affects derived loggers too.
+func (l *Logger) SetFormat(format string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf("Unknown log format '%s', supported formats are %s and %s", format, LogFormatText, LogFormatJSON)
+	}
+
+	l.output.mtx.Lock()
+	l.output.format = format
+	l.output.mtx.Unlock()
+
+	return nil
+}
+
+// Format Get the format entries are written in.
+func (l *Logger) Format() string {
+	l.output.mtx.Lock()
+	defer l.output.mtx.Unlock()
+
+	return l.output.format
+}
+
+// SetOutput Write entries to out. Affects derived loggers too.
+func (l *Logger) SetOutput(out io.Writer) {
+	l.output.mtx.Lock()
+	l.output.out = out
+	l.output.mtx.Unlock()
+}
+
+// With Get a logger that adds fields to every entry.
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	return &Logger{
+		output: l.output,
+		fields: merged,
+	}
+}
+
+// Debug Log details only useful when looking into a problem.
+func (l *Logger) Debug(msg string, fields ...Fields) {
+	l.log(LevelDebug, msg, fields)
+}
+
+// Info Log normal operation.
+func (l *Logger) Info(msg string, fields ...Fields) {
+	l.log(LevelInfo, msg, fields)
+}
+
+// Warn Log something that is wrong, but that we carry on from.
+func (l *Logger) Warn(msg string, fields ...Fields) {
+	l.log(LevelWarn, msg, fields)
+}
+
+// Error Log a failed operation, the cause goes in the error field.
+func (l *Logger) Error(msg string, fields ...Fields) {
+	l.log(LevelError, msg, fields)
+}
+
+// log Write an entry if its level is enabled.
+func (l *Logger) log(level LogLevel, msg string, extra []Fields) {
+	l.output.mtx.Lock()
+	defer l.output.mtx.Unlock()
+
+	if level < l.output.level {
+		return
+	}
+
+	entry := make(Fields, len(l.fields))
+	for key, value := range l.fields {
+		entry[key] = value
+	}
+
+	for _, fields := range extra {
+		for key, value := range fields {
+			entry[key] = value
+		}
+	}
+
+	// Values are written in a form that reads well in both formats.
+	for key, value := range entry {
+		switch v := value.(type) {
+		case error:
+			entry[key] = v.Error()
+		case time.Duration:
+			entry[key] = v.String()
+		case fmt.Stringer:
+			entry[key] = v.String()
+		}
+	}
+
+	now := time.Now()
+
+	if l.output.format == LogFormatJSON {
+		entry["time"] = now.Format(time.RFC3339Nano)
+		entry["level"] = level.String()
+		entry["msg"] = msg
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			line, _ = json.Marshal(Fields{"time": entry["time"], "level": entry["level"], "msg": msg, "error": err.Error()})
+		}
+
+		l.output.out.Write(append(line, '\n'))
+		return
+	}
+
+	var keys []string
+	for key := range entry {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var line strings.Builder
+	fmt.Fprintf(&line, "%s %-5s %s", now.Format("2006/01/02 15:04:05"), strings.ToUpper(level.String()), msg)
+
+	for _, key := range keys {
+		value := fmt.Sprint(entry[key])
+		if value == "" || strings.ContainsAny(value, " \t\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+
+		fmt.Fprintf(&line, " %s=%s", key, value)
+	}
+
+	line.WriteString("\n")
+	l.output.out.Write([]byte(line.String()))
+}
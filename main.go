@@ -5,25 +5,23 @@ Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-func printUsage(msg string) {
-	fmt.Fprintf(os.Stderr, "Usage:\n")
-	fmt.Fprintf(os.Stderr, "\tSynchronize path to remote target:\n")
-	fmt.Fprintf(os.Stderr, "\t\t%s sync <path-to-sync> <remote-host> <port>\n\n", os.Args[0])
-	fmt.Fprintf(os.Stderr, "\tReceive data (listen-mode):\n")
-	fmt.Fprintf(os.Stderr, "\t\t%s receive <target-path> <listen-port>\n\n", os.Args[0])
-
-	if len(msg) > 0 {
-		fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
-	}
-
-	os.Exit(1)
-}
+// version Set at build time with -ldflags "-X main.version=...".
+var version = "dev"
 
 func isValidPort(portStr string) bool {
 	n, err := strconv.Atoi(portStr)
@@ -34,112 +32,754 @@ func isValidPort(portStr string) bool {
 	return true
 }
 
-// Initial file synchronization called before we start
-// our fsnotify watcher.
-func initialSync(tq *TransferManager, path string) {
-	directories := ListDirectories(path)
-	files := ListFiles(path)
+// maxBlockSize Blocks have to fit in a gRPC message, which is limited to 4MiB.
+const maxBlockSize = 4*1024*1024 - 64*1024
 
-	for _, dir := range directories {
-		tq.Add(QueueItem{
-			Action: TmActionMkdir,
-			Path:   dir,
-			Mode:   GetFileMode(dir),
-		})
+// printSummary Print what was transferred and what failed.
+func printSummary(title string, summary TransferSummary) {
+	var actions []string
+	for action := range summary.Processed {
+		actions = append(actions, action)
 	}
 
-	for _, file := range files {
-		tq.Add(QueueItem{
-			Action: TmActionWrite,
-			Path:   file,
-		})
+	sort.Strings(actions)
+
+	fmt.Printf("%s:\n", title)
+	for _, action := range actions {
+		fmt.Printf("\t%s\t%d\n", action, summary.Processed[action])
+	}
+
+	fmt.Printf("\tFAILED\t%d\n", len(summary.Failed))
+	for _, failed := range summary.Failed {
+		fmt.Printf("\t\t%s\t%s\t%s\n", failed.Item.ActionName(), failed.Item.Path, failed.Err)
 	}
 }
 
-// sync command entrypoint.
-func syncCmd(path string) {
-	remote := "127.0.0.1:9090"
+// enterDirectory Check that path is a directory and make it our working
+// directory, all paths sent over the wire are relative to it.
+func enterDirectory(cmd *command, flags *flag.FlagSet, path string) {
+	fInfo, err := os.Stat(path)
 
-	if len(os.Args) == 4 {
-		remote = fmt.Sprintf("%s:9090", os.Args[3])
-	} else if len(os.Args) == 5 {
-		if !isValidPort(os.Args[4]) {
-			printUsage(fmt.Sprintf("%s is not a valid port number.", os.Args[4]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			cmd.usageError(flags, fmt.Sprintf("%s is not a directory.", path))
 		}
-		remote = fmt.Sprintf("%s:%s", os.Args[3], os.Args[4])
+
+		cmd.usageError(flags, fmt.Sprintf("%s: %s.", path, err.Error()))
 	}
 
-	log.Printf("Connecting to %s\n", remote)
+	if !fInfo.IsDir() {
+		cmd.usageError(flags, fmt.Sprintf("%s is not a directory.", path))
+	}
 
-	sender := NewSender()
-	err := sender.Connect(remote)
+	err = os.Chdir(path)
 	ExitIfError(err)
+}
 
-	txManager := NewTransferManager(sender)
+// shutdown Call stop to shut down gracefully. If another SIGINT or SIGTERM
+// arrives before it is done we exit right away.
+func shutdown(sig os.Signal, signals chan os.Signal, stop func()) {
+	logger.Info("Shutting down, send the signal again to exit right away", Fields{"signal": sig})
+
+	done := make(chan struct{})
+	go func() {
+		stop()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				logger.Warn("Exiting without shutting down", Fields{"signal": sig})
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// connectJobs Create the jobs and connect them to their receivers, for
+// running them once.
+func connectJobs(configs []JobConfig) []*Job {
+	var jobs []*Job
+
+	for _, config := range configs {
+		job, err := NewJob(config, logger.With(Fields{"job": config.Name}))
+		ExitIfError(err)
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+// startControl Serve the control socket at path for the status command.
+// Returns nil if path is empty, or if the default socket is in use by
+// another sync process.
+func startControl(path string, jobs func() []*Job) *ControlServer {
+	if path == "" {
+		return nil
+	}
+
+	control, err := NewControlServer(path, jobs)
+	if err != nil && path == defaultControlSocket() {
+		logger.Warn("Status command not available", Fields{"error": err})
+		return nil
+	}
 
-	fileWatcher := NewFileWatcher(txManager)
-	err = fileWatcher.Start()
 	ExitIfError(err)
+	control.Start()
 
-	initialSync(txManager, path)
-	txManager.Start()
+	return control
 }
 
-// receive command entrypoint.
-func receiveCmd(path string) {
-	listenAddr := ":9090"
+// sync command entrypoint.
+func syncCmd(cmd *command, args []string) {
+	var (
+		configPath      string
+		once            bool
+		dryRun          bool
+		exclude         listFlag
+		shutdownTimeout time.Duration
+		metricsAddr     string
+		progressMode    string
+		progressEvery   time.Duration
+		controlPath     string
+	)
+
+	jc := DefaultJobConfig()
+
+	flags := cmd.newFlagSet()
+	flags.StringVar(&configPath, "config", "", "Read the jobs to run from a YAML config file, instead of syncing a single path")
+	flags.StringVar(&jc.Remote, "remote", jc.Remote, "Address of the receiver as host:port")
+	flags.Var(&exclude, "exclude", "Pattern of paths not to sync, can be given more than once or as a comma-separated list")
+	flags.Int64Var(&jc.BlockSize, "block-size", jc.BlockSize, "Size of the blocks files are compared and sent in, 0 picks one based on the file size")
+	flags.IntVar(&jc.MaxRetries, "max-retries", jc.MaxRetries, "How many times an operation that failed because the receiver was unreachable, too slow or out of space is retried, with backoff")
+	flags.DurationVar(&jc.RPCTimeout, "rpc-timeout", jc.RPCTimeout, "How long creating, renaming, deleting and other operations on metadata may take on the receiver, 0 for no limit")
+	flags.DurationVar(&jc.BlockTimeout, "block-timeout", jc.BlockTimeout, "How long writing a block may take on the receiver, 0 for no limit")
+	flags.DurationVar(&jc.ChecksumTimeout, "checksum-timeout", jc.ChecksumTimeout, "How long operations that read a whole file on the receiver may take, like checksumming it, 0 for no limit")
+	flags.DurationVar(&jc.ListTimeout, "list-timeout", jc.ListTimeout, "How long listing the tree of the receiver may take, 0 for no limit")
+	flags.BoolVar(&jc.Verify, "verify", jc.Verify, "Check each file against the receiver after sending it, and send it again in full if it doesn't match. Costs reading the file again on receivers that can't resume transfers")
+	flags.Var(&jc.BandwidthLimit, "bwlimit", "Limit the rate file data is sent at, in bytes per second like 500K or 2M, off for no limit")
+	flags.Var(&jc.BandwidthSchedule, "bwlimit-schedule", "Bandwidth limits by time of day as HH:MM=<bandwidth>, can be given more than once or as a comma-separated list")
+	flags.StringVar(&jc.Watcher, "watcher", jc.Watcher, "How to watch for changes: auto, inotify, fanotify or poll")
+	flags.DurationVar(&jc.PollInterval, "poll-interval", jc.PollInterval, "How often the poll watcher scans the tree")
+	flags.DurationVar(&jc.ReconcileInterval, "reconcile-interval", jc.ReconcileInterval, "How often to compare the tree against the receiver and fix drift, 0 disables it")
+	flags.BoolVar(&jc.ReconcileChecksums, "reconcile-checksums", jc.ReconcileChecksums, "Compare file content by checksum when reconciling, not only size and mode")
+	flags.BoolVar(&once, "once", false, "Sync the tree once, print a summary and exit")
+	flags.BoolVar(&dryRun, "dry-run", false, "Print what a sync would change without changing anything")
+	flags.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "How long to wait for the file being transferred when shutting down before cancelling it")
+	flags.StringVar(&metricsAddr, "metrics-listen", "", "Serve Prometheus metrics on /metrics at this [host]:port, disabled if empty")
+	flags.StringVar(&progressMode, "progress", ProgressAuto, "How to report transfer progress: auto, tty, log or off")
+	flags.DurationVar(&progressEvery, "progress-interval", 10*time.Second, "How often progress is logged when it is not shown on a terminal, 0 disables it")
+	flags.StringVar(&controlPath, "control-socket", defaultControlSocket(), "Unix socket the status command talks to, disabled if empty")
+	cmd.parseFlags(flags, args)
+
+	progress, err := NewProgressReporter(progressMode, progressEvery)
+	if err != nil {
+		cmd.usageError(flags, err.Error()+".")
+	}
+
+	args = flags.Args()
+	var jobs []JobConfig
+
+	if configPath != "" {
+		if len(args) > 0 {
+			cmd.usageError(flags, "No arguments are accepted with -config.")
+		}
+
+		config, err := LoadConfig(configPath)
+		ExitIfError(err)
+
+		jobs = config.Jobs
+	} else {
+		if len(args) < 1 || len(args) > 3 {
+			cmd.usageError(flags, "Wrong number of arguments.")
+		}
 
-	if len(os.Args) == 4 {
-		if !isValidPort(os.Args[3]) {
-			printUsage(fmt.Sprintf("%s is not a valid port number.", os.Args[4]))
+		// The remote can also be given as arguments, like older versions did.
+		if len(args) == 2 {
+			jc.Remote = fmt.Sprintf("%s:9090", args[1])
+		} else if len(args) == 3 {
+			jc.Remote = fmt.Sprintf("%s:%s", args[1], args[2])
 		}
 
-		listenAddr = fmt.Sprintf(":%s", os.Args[3])
+		jc.Name = args[0]
+		jc.Path = args[0]
+		jc.Exclude = exclude
+
+		if errs := jc.Validate(); len(errs) > 0 {
+			cmd.usageError(flags, strings.Join(errs, ", ")+".")
+		}
+
+		jobs = append(jobs, jc)
 	}
 
+	// Only show what would be changed.
+	if dryRun {
+		runningJobs := connectJobs(jobs)
+
+		for _, job := range runningJobs {
+			if len(runningJobs) > 1 {
+				fmt.Printf("Job %s:\n", job.Name())
+			}
+
+			err := job.DryRun(os.Stdout)
+			ExitIfError(err)
+		}
+
+		return
+	}
+
+	if metricsAddr != "" {
+		err := ServeMetrics(metricsAddr, senderRegistry)
+		ExitIfError(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	// Sync what is there now and exit, without watching for changes.
+	if once {
+		var wg sync.WaitGroup
+
+		runningJobs := connectJobs(jobs)
+		interrupted := make(chan struct{})
+
+		go func() {
+			for sig := range signals {
+				if sig == syscall.SIGHUP {
+					continue
+				}
+
+				close(interrupted)
+				shutdown(sig, signals, func() {
+					for _, job := range runningJobs {
+						job.Stop(shutdownTimeout)
+					}
+				})
+				return
+			}
+		}()
+		listJobs := func() []*Job { return runningJobs }
+
+		control := startControl(controlPath, listJobs)
+
+		if progress != nil {
+			progress.Start(listJobs)
+		}
+
+		summaries := make([]TransferSummary, len(runningJobs))
+
+		for i, job := range runningJobs {
+			wg.Add(1)
+			go func(i int, job *Job) {
+				defer wg.Done()
+				summaries[i] = job.RunOnce()
+			}(i, job)
+		}
+
+		wg.Wait()
+
+		if progress != nil {
+			progress.Stop()
+		}
+
+		failed := false
+		for i, job := range runningJobs {
+			title := "Summary"
+			if len(runningJobs) > 1 {
+				title = fmt.Sprintf("Summary of %s", job.Name())
+			}
+
+			printSummary(title, summaries[i])
+			failed = failed || len(summaries[i].Failed) > 0
+		}
+
+		control.Close()
+
+		select {
+		case <-interrupted:
+			logger.Warn("Interrupted, not everything was synced")
+			os.Exit(1)
+		default:
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	runner := NewJobRunner(shutdownTimeout)
+
+	control := startControl(controlPath, runner.Jobs)
+	defer control.Close()
+
+	if progress != nil {
+		progress.Start(runner.Jobs)
+	}
+
+	err = runner.Apply(jobs)
+	ExitIfError(err)
+
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			shutdown(sig, signals, func() {
+				runner.Stop()
+
+				if progress != nil {
+					progress.Stop()
+				}
+			})
+			return
+		}
+
+		if configPath == "" {
+			logger.Warn("No config file to reload", Fields{"signal": sig})
+			continue
+		}
+
+		logger.Info("Reloading config", Fields{"config": configPath})
+
+		config, err := LoadConfig(configPath)
+		if err != nil {
+			logger.Error("Failed to reload config, keeping the current one", Fields{"error": err})
+			continue
+		}
+
+		err = runner.Apply(config.Jobs)
+		if err != nil {
+			logger.Error("Failed to apply config", Fields{"error": err})
+		}
+	}
+}
+
+// receive command entrypoint.
+func receiveCmd(cmd *command, args []string) {
+	var (
+		listenAddr      string
+		shutdownTimeout time.Duration
+		metricsAddr     string
+	)
+
 	receiver := NewReceiver()
 
-	log.Printf("Listening on %s\n", listenAddr)
+	flags := cmd.newFlagSet()
+	flags.StringVar(&listenAddr, "listen", ":9090", "Address to listen on as [host]:port")
+	flags.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "How long to wait for RPCs in flight when shutting down before cancelling them")
+	flags.StringVar(&metricsAddr, "metrics-listen", "", "Serve Prometheus metrics on /metrics at this [host]:port, disabled if empty")
+	flags.BoolVar(&receiver.Reflection, "reflection", false, "Register the gRPC server reflection service, for tools like grpcurl")
+	flags.DurationVar(&receiver.HealthInterval, "health-interval", receiver.HealthInterval, "How often to check that the target path is writable for the gRPC health service")
+	flags.Int64Var(&receiver.MinFreeSpace, "health-min-free", 0, "Report not serving when no more than this many bytes are free on the target filesystem")
+	flags.DurationVar(&receiver.PartialMaxAge, "partial-max-age", receiver.PartialMaxAge, "How long an interrupted transfer is kept for the sender to resume it")
+	cmd.parseFlags(flags, args)
+
+	args = flags.Args()
+	if len(args) < 1 || len(args) > 2 {
+		cmd.usageError(flags, "Wrong number of arguments.")
+	}
+
+	// The port can also be given as argument, like older versions did.
+	if len(args) == 2 {
+		if !isValidPort(args[1]) {
+			cmd.usageError(flags, fmt.Sprintf("%s is not a valid port number.", args[1]))
+		}
+
+		listenAddr = fmt.Sprintf(":%s", args[1])
+	}
+
+	if receiver.HealthInterval <= 0 {
+		cmd.usageError(flags, "-health-interval has to be positive.")
+	}
+
+	enterDirectory(cmd, flags, args[0])
+
+	if metricsAddr != "" {
+		err := ServeMetrics(metricsAddr, receiverRegistry)
+		ExitIfError(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		shutdown(sig, signals, func() {
+			receiver.Stop(shutdownTimeout)
+		})
+	}()
+
 	err := receiver.Start(listenAddr)
 	ExitIfError(err)
 }
 
-func main() {
-	if len(os.Args) < 3 {
-		printUsage("Not enough arguments.")
+// status command entrypoint.
+func statusCmd(cmd *command, args []string) {
+	var (
+		controlPath string
+		asJSON      bool
+	)
+
+	flags := cmd.newFlagSet()
+	flags.StringVar(&controlPath, "control-socket", defaultControlSocket(), "Control socket of the sync process")
+	flags.BoolVar(&asJSON, "json", false, "Print the status as JSON")
+	cmd.parseFlags(flags, args)
+
+	if flags.NArg() > 0 {
+		cmd.usageError(flags, "No arguments are accepted.")
 	}
 
-	mode := os.Args[1]
-	path := os.Args[2]
+	report := &StatusReport{}
+	err := controlRequest(controlPath, http.MethodGet, "/status", nil, report)
+	ExitIfError(err)
 
-	// Check if a valid mode is specified.
-	if mode != "sync" && mode != "receive" {
-		printUsage(fmt.Sprintf("%s is invalid mode. Supported modes are sync and receive.", mode))
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+		return
 	}
 
-	fInfo, err := os.Stat(path)
+	printStatus(os.Stdout, report)
+}
 
-	// Check if specified path is a directory.
-	if err != nil {
-		if os.IsNotExist(err) {
-			printUsage(fmt.Sprintf("%s is not a directory.", path))
+// bwlimit command entrypoint.
+func bwlimitCmd(cmd *command, args []string) {
+	var (
+		controlPath string
+		jobName     string
+	)
+
+	flags := cmd.newFlagSet()
+	flags.StringVar(&controlPath, "control-socket", defaultControlSocket(), "Control socket of the sync process")
+	flags.StringVar(&jobName, "job", "", "Only change the limit of this job")
+	cmd.parseFlags(flags, args)
+
+	var limits []BandwidthStatus
+	var err error
+
+	switch flags.NArg() {
+	case 0:
+		if jobName != "" {
+			cmd.usageError(flags, "-job is only accepted when changing the limit.")
+		}
+
+		err = controlRequest(controlPath, http.MethodGet, "/bwlimit", nil, &limits)
+
+	case 1:
+		req := BandwidthRequest{Job: jobName}
+		if flags.Arg(0) == "reset" {
+			req.Reset = true
+		} else if _, err := ParseByteRate(flags.Arg(0)); err != nil {
+			cmd.usageError(flags, err.Error()+".")
 		} else {
-			printUsage(fmt.Sprintf("%s: %s.", path, err.Error()))
+			req.Limit = flags.Arg(0)
 		}
+
+		err = controlRequest(controlPath, http.MethodPost, "/bwlimit", req, &limits)
+
+	default:
+		cmd.usageError(flags, "Wrong number of arguments.")
 	}
 
-	if !fInfo.IsDir() {
-		printUsage(fmt.Sprintf("%s is not a directory.", path))
+	ExitIfError(err)
+
+	for _, limit := range limits {
+		from := "config"
+		if limit.Override {
+			from = "set at runtime"
+		} else if len(limit.Schedule) > 0 {
+			from = "schedule " + strings.Join(limit.Schedule, ",")
+		}
+
+		fmt.Printf("%s\t%s\t(%s)\n", limit.Job, limit.Limit, from)
 	}
+}
 
-	err = os.Chdir(path)
+// failed command entrypoint.
+func failedCmd(cmd *command, args []string) {
+	var (
+		controlPath string
+		jobName     string
+		asJSON      bool
+	)
+
+	flags := cmd.newFlagSet()
+	flags.StringVar(&controlPath, "control-socket", defaultControlSocket(), "Control socket of the sync process")
+	flags.StringVar(&jobName, "job", "", "Only show the failed items of this job")
+	flags.BoolVar(&asJSON, "json", false, "Print the failed items as JSON")
+	cmd.parseFlags(flags, args)
+
+	if flags.NArg() > 0 {
+		cmd.usageError(flags, "No arguments are accepted.")
+	}
+
+	var failed []FailedStatus
+	err := controlRequest(controlPath, http.MethodGet, "/failed", nil, &failed)
+	ExitIfError(err)
+
+	if jobName != "" {
+		var matched []FailedStatus
+		for _, job := range failed {
+			if job.Job == jobName {
+				matched = append(matched, job)
+			}
+		}
+
+		if len(matched) == 0 {
+			ExitIfError(fmt.Errorf("No job named '%s'", jobName))
+		}
+
+		failed = matched
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(failed)
+		return
+	}
+
+	printFailed(os.Stdout, failed)
+}
+
+// retry command entrypoint.
+func retryCmd(cmd *command, args []string) {
+	var (
+		controlPath string
+		jobName     string
+	)
+
+	flags := cmd.newFlagSet()
+	flags.StringVar(&controlPath, "control-socket", defaultControlSocket(), "Control socket of the sync process")
+	flags.StringVar(&jobName, "job", "", "Only retry the failed items of this job")
+	cmd.parseFlags(flags, args)
+
+	// Relative paths are taken as relative to the directory of the job.
+	req := RetryRequest{
+		Job:   jobName,
+		Paths: flags.Args(),
+	}
+
+	var retried []FailedStatus
+	err := controlRequest(controlPath, http.MethodPost, "/retry", req, &retried)
 	ExitIfError(err)
 
-	switch mode {
-	case "sync":
-		syncCmd(path)
+	for _, job := range retried {
+		fmt.Printf("Job %s: %d queued again\n", job.Job, len(job.Items))
+
+		for _, item := range job.Items {
+			fmt.Printf("\t%s\n", formatQueueEntry(item.QueueEntry))
+		}
+	}
+}
+
+// verify command entrypoint.
+func verifyCmd(cmd *command, args []string) {
+	var (
+		configPath string
+		jobName    string
+		exclude    listFlag
+		checksums  bool
+		asJSON     bool
+	)
+
+	jc := DefaultJobConfig()
+
+	flags := cmd.newFlagSet()
+	flags.StringVar(&configPath, "config", "", "Verify the jobs in a YAML config file, instead of a single path")
+	flags.StringVar(&jobName, "job", "", "Only verify this job of the config file")
+	flags.StringVar(&jc.Remote, "remote", jc.Remote, "Address of the receiver as host:port")
+	flags.Var(&exclude, "exclude", "Pattern of paths not to verify, can be given more than once or as a comma-separated list")
+	flags.BoolVar(&checksums, "checksums", true, "Compare file content by checksum, not only size and mode")
+	flags.BoolVar(&asJSON, "json", false, "Print the reports as JSON")
+	cmd.parseFlags(flags, args)
+
+	args = flags.Args()
+	var jobs []JobConfig
+
+	if configPath != "" {
+		if len(args) > 0 {
+			cmd.usageError(flags, "No arguments are accepted with -config.")
+		}
+
+		config, err := LoadConfig(configPath)
+		ExitIfError(err)
+
+		for _, job := range config.Jobs {
+			if jobName == "" || job.Name == jobName {
+				jobs = append(jobs, job)
+			}
+		}
+
+		if len(jobs) == 0 {
+			cmd.usageError(flags, fmt.Sprintf("No job named '%s' in %s.", jobName, configPath))
+		}
+	} else {
+		if len(args) != 1 {
+			cmd.usageError(flags, "Wrong number of arguments.")
+		}
+
+		if jobName != "" {
+			cmd.usageError(flags, "-job is only accepted with -config.")
+		}
+
+		jc.Name = args[0]
+		jc.Path = args[0]
+		jc.Exclude = exclude
+
+		if errs := jc.Validate(); len(errs) > 0 {
+			cmd.usageError(flags, strings.Join(errs, ", ")+".")
+		}
+
+		jobs = append(jobs, jc)
+	}
+
+	var reports []*VerifyReport
+	differs := false
+
+	for _, job := range connectJobs(jobs) {
+		report, err := job.Verify(checksums)
+		ExitIfError(err)
+
+		job.logger.Info("Verified", Fields{
+			"files":       report.Files,
+			"directories": report.Directories,
+			"bytes":       report.Bytes,
+			"differences": len(report.Differences),
+		})
+
+		reports = append(reports, report)
+		differs = differs || len(report.Differences) > 0
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(reports)
+	} else {
+		for _, report := range reports {
+			if len(reports) > 1 {
+				fmt.Printf("Job %s:\n", report.Job)
+			}
+
+			report.Write(os.Stdout)
+		}
+	}
+
+	if differs {
+		os.Exit(1)
+	}
+}
+
+// version command entrypoint.
+func versionCmd(cmd *command, args []string) {
+	flags := cmd.newFlagSet()
+	cmd.parseFlags(flags, args)
+
+	fmt.Printf("filewatcher %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
 
-	case "receive":
-		receiveCmd(path)
+// commands All commands of filewatcher.
+var commands = []*command{
+	{
+		name:     "sync",
+		synopsis: "Sync a directory to a receiver and keep it in sync",
+		usage:    "[flags] <path-to-sync> [<remote-host> [<port>]]\n\t" + os.Args[0] + " sync [flags] -config <file>",
+		description: "Synchronize path to the receiver and keep it in sync as files change.\n" +
+			"The receiver can be given with -remote or as arguments. With -config all jobs\n" +
+			"in the config file are run, the options of a job are then taken from the file.",
+		run: syncCmd,
+	},
+	{
+		name:     "receive",
+		synopsis: "Receive files from a sender",
+		usage:    "[flags] <target-path> [<listen-port>]",
+		description: "Receive data from a sender and write it to target-path (listen-mode).\n" +
+			"The listen address can be given with -listen or as port argument.",
+		run: receiveCmd,
+	},
+	{
+		name:     "status",
+		synopsis: "Show what a running sync process is doing",
+		usage:    "[flags]",
+		description: "Show what a running sync process is doing: the connection, queue and file\n" +
+			"in flight of every job, along with totals and recent errors.",
+		run: statusCmd,
+	},
+	{
+		name:     "bwlimit",
+		synopsis: "Show or change the bandwidth limits of a running sync process",
+		usage:    "[flags] [<bandwidth>|reset]",
+		description: "Show the bandwidth limits of a running sync process, or change them until it\n" +
+			"exits or reset is given. The bandwidth is in bytes per second, like 500K or 2M,\n" +
+			"or off for no limit.",
+		run: bwlimitCmd,
+	},
+	{
+		name:     "failed",
+		synopsis: "Show the operations of a running sync process that failed for good",
+		usage:    "[flags]",
+		description: "Show the operations of a running sync process that failed for good, with the\n" +
+			"gRPC status code and error of each. Operations failing because the receiver was\n" +
+			"unreachable, too slow or out of space are retried by themselves first.",
+		run: failedCmd,
+	},
+	{
+		name:     "retry",
+		synopsis: "Retry the operations of a running sync process that failed for good",
+		usage:    "[flags] [<path>...]",
+		description: "Queue the operations of a running sync process that failed for good again, only\n" +
+			"those of the given paths if any are given. Paths are relative to the synced\n" +
+			"directory or absolute.",
+		run: retryCmd,
+	},
+	{
+		name:     "verify",
+		synopsis: "Compare a directory to the receiver without changing anything",
+		usage:    "[flags] <path>\n\t" + os.Args[0] + " verify [flags] -config <file>",
+		description: "Compare path to the receiver by path, type, size, mode and checksum, and print\n" +
+			"every difference as a tab-separated line of kind, path, local and remote value.\n" +
+			"The exit status is non-zero if anything differs. Nothing is changed on the\n" +
+			"receiver.",
+		run: verifyCmd,
+	},
+	{
+		name:        "version",
+		synopsis:    "Print the version of filewatcher",
+		usage:       "",
+		description: "Print the version of filewatcher.",
+		run:         versionCmd,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage(commands)
+		os.Exit(2)
 	}
+
+	name := os.Args[1]
+
+	switch name {
+	case "help", "-h", "-help", "--help":
+		printUsage(commands)
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmd.run(cmd, os.Args[2:])
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: unknown command %s\n\n", name)
+	printUsage(commands)
+	os.Exit(2)
 }
@@ -0,0 +1,132 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// senderRegistry Metrics exported by the sync command.
+	senderRegistry = newRegistry()
+
+	// receiverRegistry Metrics exported by the receive command.
+	receiverRegistry = newRegistry()
+
+	queueLength = promauto.With(senderRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "filewatcher_queue_length",
+		Help: "Number of operations waiting to be sent to the receiver.",
+	}, []string{"job"})
+
+	operations = promauto.With(senderRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "filewatcher_operations_total",
+		Help: "Operations sent to the receiver by action and outcome.",
+	}, []string{"job", "action", "outcome"})
+
+	bytesSent = promauto.With(senderRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "filewatcher_sent_bytes_total",
+		Help: "Bytes of file data sent to the receiver.",
+	}, []string{"job"})
+
+	bytesSkipped = promauto.With(senderRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "filewatcher_skipped_bytes_total",
+		Help: "Bytes of file data not sent because the receiver already had them.",
+	}, []string{"job"})
+
+	fileSyncDuration = promauto.With(senderRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "filewatcher_file_sync_duration_seconds",
+		Help:    "Time taken to sync a file to the receiver.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"job"})
+
+	reconnects = promauto.With(senderRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "filewatcher_reconnects_total",
+		Help: "Times the connection to the receiver was re-established after being lost.",
+	}, []string{"job"})
+
+	verifyFailures = promauto.With(senderRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "filewatcher_verify_failures_total",
+		Help: "Files that didn't match on the receiver after being sent.",
+	}, []string{"job"})
+
+	receiverRPCs = promauto.With(receiverRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "filewatcher_receiver_rpcs_total",
+		Help: "RPCs served by the receiver by method and status code.",
+	}, []string{"method", "code"})
+
+	receiverBytesWritten = promauto.With(receiverRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "filewatcher_receiver_written_bytes_total",
+		Help: "Bytes of file data written by the receiver.",
+	})
+)
+
+// newRegistry Create a registry with the Go runtime and process metrics.
+func newRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGoCollector())
+	registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	return registry
+}
+
+// jobMetrics The metrics of a single job.
+type jobMetrics struct {
+	job            string
+	queueLength    prometheus.Gauge
+	operations     *prometheus.CounterVec
+	bytesSent      prometheus.Counter
+	bytesSkipped   prometheus.Counter
+	syncDuration   prometheus.Observer
+	reconnects     prometheus.Counter
+	verifyFailures prometheus.Counter
+}
+
+// newJobMetrics Get the metrics of a job.
+func newJobMetrics(job string) *jobMetrics {
+	labels := prometheus.Labels{"job": job}
+
+	return &jobMetrics{
+		job:            job,
+		queueLength:    queueLength.With(labels),
+		operations:     operations.MustCurryWith(labels),
+		bytesSent:      bytesSent.With(labels),
+		bytesSkipped:   bytesSkipped.With(labels),
+		syncDuration:   fileSyncDuration.With(labels),
+		reconnects:     reconnects.With(labels),
+		verifyFailures: verifyFailures.With(labels),
+	}
+}
+
+// remove Stop exporting the queue length of a job that no longer runs. The
+// counters are kept, so rates over them stay correct.
+func (m *jobMetrics) remove() {
+	queueLength.DeleteLabelValues(m.job)
+}
+
+// ServeMetrics Serve the metrics of registry on /metrics at address in the
+// background.
+func ServeMetrics(address string, registry *prometheus.Registry) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	logger.Info("Serving metrics", Fields{"address": listener.Addr().String()})
+
+	go func() {
+		err := http.Serve(listener, mux)
+		logger.Error("Metrics server stopped", Fields{"error": err})
+	}()
+
+	return nil
+}
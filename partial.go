@@ -0,0 +1,486 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// partialDir Directory in the target path where files being transferred are
+// kept until they are complete.
+const partialDir = ".filewatcher-partial"
+
+// partialState What is being transferred. A partial transfer is only resumed
+// for the same version of the source file, sent in the same block size.
+type partialState struct {
+	Path      string `json:"path"`
+	Checksum  string `json:"checksum"`
+	Size      int64  `json:"size"`
+	BlockSize int64  `json:"block_size"`
+}
+
+// partialTransfer A file being transferred. The data starts out as a copy of
+// the current file, so only the blocks that differ have to be sent, and
+// every block written is logged so a transfer that is interrupted can be
+// resumed.
+type partialTransfer struct {
+	partialState
+
+	// Path of the files of the transfer, without extension.
+	name     string
+	data     *os.File
+	blocks   *os.File
+	received map[int64]bool
+
+	// Set once the files are set up, until the transfer is committed or
+	// discarded.
+	active bool
+
+	// Held while the files are set up, written or committed.
+	mtx sync.Mutex
+}
+
+// partialTransfers The transfers in progress on a receiver, by path.
+type partialTransfers struct {
+	transfers map[string]*partialTransfer
+	mtx       sync.Mutex
+}
+
+// newPartialTransfers Create new instance of partialTransfers.
+func newPartialTransfers() *partialTransfers {
+	return &partialTransfers{
+		transfers: make(map[string]*partialTransfer),
+	}
+}
+
+// partialName Path of the files of a transfer of path, without extension.
+func partialName(path string) string {
+	sum := md5.Sum([]byte(filepath.Clean(path)))
+	return filepath.Join(partialDir, hex.EncodeToString(sum[:]))
+}
+
+// isPartialPath Check if path is where partial transfers are kept.
+func isPartialPath(path string) bool {
+	return path == partialDir || strings.HasPrefix(path, partialDir+string(filepath.Separator))
+}
+
+// begin Start a transfer, or resume the one of the same version of the file
+// in progress or left by an earlier attempt. Only finding the transfer is
+// done with mtx held, the files are set up with the lock of the transfer, so
+// a Begin retried while the first is still copying the file waits for it
+// and resumes it.
+func (p *partialTransfers) begin(req *BeginTransferRequest) (*BeginTransferResponse, error) {
+	path := filepath.Clean(req.GetPath())
+	state := partialState{
+		Path:      path,
+		Checksum:  req.GetChecksum(),
+		Size:      req.GetSize(),
+		BlockSize: req.GetBlockSize(),
+	}
+
+	t, stale, created := p.lookup(state)
+	for !created {
+		t.mtx.Lock()
+		if t.active {
+			break
+		}
+
+		// It failed to be set up or was committed since, and is gone.
+		t.mtx.Unlock()
+		t, stale, created = p.lookup(state)
+	}
+
+	defer t.mtx.Unlock()
+
+	resumed := !created
+
+	if created {
+		// The stale transfer uses the same files, so it has to be gone first.
+		if stale != nil {
+			stale.mtx.Lock()
+			stale.discard()
+			stale.mtx.Unlock()
+		}
+
+		resumed = t.load()
+		if !resumed {
+			err := t.create()
+			if err != nil {
+				p.remove(t)
+				return nil, err
+			}
+		}
+
+		t.active = true
+	}
+
+	resp := &BeginTransferResponse{Resumed: resumed}
+	for index := range t.received {
+		resp.ReceivedBlocks = append(resp.ReceivedBlocks, index)
+	}
+
+	sort.Slice(resp.ReceivedBlocks, func(i, k int) bool {
+		return resp.ReceivedBlocks[i] < resp.ReceivedBlocks[k]
+	})
+
+	return resp, nil
+}
+
+// lookup Find the transfer of the version of the file in state, or add a
+// new one which is returned locked and has to be set up. A transfer of
+// another version is replaced, it is returned as stale.
+func (p *partialTransfers) lookup(state partialState) (t *partialTransfer, stale *partialTransfer, created bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	t, ok := p.transfers[state.Path]
+	if ok && t.partialState == state {
+		return t, nil, false
+	}
+
+	stale = t
+	t = &partialTransfer{
+		partialState: state,
+		name:         partialName(state.Path),
+		received:     make(map[int64]bool),
+	}
+
+	// Nobody else can have it yet, so this doesn't block.
+	t.mtx.Lock()
+	p.transfers[state.Path] = t
+
+	return t, stale, true
+}
+
+// remove Forget the transfer t, unless it has been replaced already.
+func (p *partialTransfers) remove(t *partialTransfer) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.transfers[t.Path] == t {
+		delete(p.transfers, t.Path)
+	}
+}
+
+// get Get the transfer of path in progress.
+func (p *partialTransfers) get(path string) (*partialTransfer, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	t, ok := p.transfers[filepath.Clean(path)]
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "No transfer of %s in progress", path)
+	}
+
+	return t, nil
+}
+
+// commit Check that the transfer of a file is complete and replace the file
+// with it. Returns the checksum of the file. Only the lock of the transfer is
+// held while the file is checksummed, so other transfers carry on.
+func (p *partialTransfers) commit(req *CommitTransferRequest) (string, error) {
+	path := filepath.Clean(req.GetPath())
+
+	t, err := p.get(path)
+	if err != nil {
+		return "", err
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if !t.active {
+		return "", status.Errorf(codes.FailedPrecondition, "No transfer of %s in progress", path)
+	}
+
+	if t.Checksum != req.GetChecksum() {
+		return "", status.Errorf(codes.FailedPrecondition, "Transfer of %s in progress is of another version of the file", path)
+	}
+
+	err = t.data.Truncate(req.GetSize())
+	if err == nil {
+		err = t.data.Sync()
+	}
+
+	if err != nil {
+		return "", fileErrorf(err, "Failed to complete %s", path)
+	}
+
+	checksum, err := GetChecksum(t.name + ".data")
+	if err != nil {
+		return "", fileErrorf(err, "Failed to get checksum of %s", path)
+	}
+
+	if checksum != t.Checksum {
+		t.discard()
+		p.remove(t)
+
+		return "", status.Errorf(codes.DataLoss, "Transfer of %s doesn't match the source, it has to be sent again", path)
+	}
+
+	err = t.data.Chmod(os.FileMode(req.GetMode()))
+	if err != nil {
+		return "", fileErrorf(err, "Failed to chmod %s", path)
+	}
+
+	// It is only forgotten once its files are gone, so a Begin of the same
+	// version waits for us instead of picking them up.
+	t.close()
+	defer p.remove(t)
+
+	err = os.Rename(t.name+".data", path)
+	if err != nil {
+		return "", fileErrorf(err, "Failed to move %s into place", path)
+	}
+
+	os.Remove(t.name + ".state")
+	os.Remove(t.name + ".blocks")
+
+	return checksum, nil
+}
+
+// clean Remove partial transfers that haven't been touched for maxAge, the
+// sender has likely given up on them.
+func (p *partialTransfers) clean(maxAge time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	active := make(map[string]bool)
+	for _, t := range p.transfers {
+		active[t.name] = true
+	}
+
+	files, err := ioutil.ReadDir(partialDir)
+	if err != nil {
+		return
+	}
+
+	for _, fInfo := range files {
+		name := filepath.Join(partialDir, strings.TrimSuffix(fInfo.Name(), filepath.Ext(fInfo.Name())))
+		if active[name] || time.Since(fInfo.ModTime()) < maxAge {
+			continue
+		}
+
+		logger.Info("Removing abandoned partial transfer", Fields{"path": filepath.Join(partialDir, fInfo.Name())})
+		os.Remove(filepath.Join(partialDir, fInfo.Name()))
+	}
+}
+
+// create Set up the files of the transfer, with the data starting out as a
+// copy of the current content of the file. Has to be called with mtx held.
+func (t *partialTransfer) create() error {
+	err := os.MkdirAll(partialDir, 0700)
+	if err != nil {
+		return fileErrorf(err, "Failed to create %s", partialDir)
+	}
+
+	t.data, err = os.OpenFile(t.name+".data", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fileErrorf(err, "Failed to create partial file for %s", t.Path)
+	}
+
+	if current, err := os.Open(t.Path); err == nil {
+		err = copySparse(t.data, current)
+		current.Close()
+
+		if err != nil {
+			t.discard()
+			return fileErrorf(err, "Failed to copy %s", t.Path)
+		}
+	}
+
+	t.blocks, err = os.OpenFile(t.name+".blocks", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		t.discard()
+		return fileErrorf(err, "Failed to create block log for %s", t.Path)
+	}
+
+	stateData, _ := json.Marshal(t.partialState)
+	err = ioutil.WriteFile(t.name+".state", stateData, 0600)
+	if err != nil {
+		t.discard()
+		return fileErrorf(err, "Failed to write state of %s", t.Path)
+	}
+
+	return nil
+}
+
+// load Open the files of the transfer left by an earlier run, if it is of
+// the same version of the file. Returns false if there is none. Has to be
+// called with mtx held.
+func (t *partialTransfer) load() bool {
+	stateData, err := ioutil.ReadFile(t.name + ".state")
+	if err != nil {
+		return false
+	}
+
+	var saved partialState
+	if json.Unmarshal(stateData, &saved) != nil || saved != t.partialState {
+		return false
+	}
+
+	blockLog, err := ioutil.ReadFile(t.name + ".blocks")
+	if err != nil {
+		return false
+	}
+
+	// A record cut short by a crash is left out, and cut off below so the
+	// records logged after it line up.
+	for i := 0; i+8 <= len(blockLog); i += 8 {
+		t.received[int64(binary.LittleEndian.Uint64(blockLog[i:]))] = true
+	}
+
+	t.data, err = os.OpenFile(t.name+".data", os.O_RDWR, 0600)
+	if err != nil {
+		t.received = make(map[int64]bool)
+		return false
+	}
+
+	t.blocks, err = os.OpenFile(t.name+".blocks", os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		err = t.blocks.Truncate(int64(len(blockLog) - len(blockLog)%8))
+	}
+
+	if err != nil {
+		t.close()
+		t.data, t.blocks = nil, nil
+		t.received = make(map[int64]bool)
+		return false
+	}
+
+	return true
+}
+
+// writeBlock Write a block and log that it was received.
+func (t *partialTransfer) writeBlock(index, offset int64, data []byte) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if !t.active {
+		return status.Errorf(codes.FailedPrecondition, "No transfer of %s in progress", t.Path)
+	}
+
+	_, err := t.data.WriteAt(data, offset)
+	if err != nil {
+		return fileErrorf(err, "Failed to write %d bytes to %s @ offset %d", len(data), t.Path, offset)
+	}
+
+	return t.logBlock(index)
+}
+
+// punchHole Deallocate a block and log that it was received.
+func (t *partialTransfer) punchHole(index, offset, size int64) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if !t.active {
+		return status.Errorf(codes.FailedPrecondition, "No transfer of %s in progress", t.Path)
+	}
+
+	// Fall back to writing zeroes if the filesystem can't punch holes.
+	if err := PunchHole(t.data, offset, size); err != nil {
+		_, err = t.data.WriteAt(make([]byte, size), offset)
+		if err != nil {
+			return fileErrorf(err, "Failed to zero %d bytes in %s @ offset %d", size, t.Path, offset)
+		}
+	}
+
+	return t.logBlock(index)
+}
+
+// logBlock Log that a block was received. Has to be called with mtx held.
+func (t *partialTransfer) logBlock(index int64) error {
+	record := make([]byte, 8)
+	binary.LittleEndian.PutUint64(record, uint64(index))
+
+	_, err := t.blocks.Write(record)
+	if err != nil {
+		return fileErrorf(err, "Failed to log block #%d of %s", index, t.Path)
+	}
+
+	t.received[index] = true
+	return nil
+}
+
+// close the files of the transfer, it can't be written to after this.
+func (t *partialTransfer) close() {
+	t.active = false
+
+	if t.data != nil {
+		t.data.Close()
+	}
+
+	if t.blocks != nil {
+		t.blocks.Close()
+	}
+}
+
+// discard Close and remove the files of the transfer.
+func (t *partialTransfer) discard() {
+	t.close()
+
+	os.Remove(t.name + ".data")
+	os.Remove(t.name + ".blocks")
+	os.Remove(t.name + ".state")
+}
+
+// copySparse Copy src into the empty file dst. The data is shared if the
+// filesystem can clone files, otherwise only the data regions of src are
+// copied so its holes stay holes in dst.
+func copySparse(dst *os.File, src *os.File) error {
+	if CloneFile(dst, src) == nil {
+		return nil
+	}
+
+	fInfo, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	holes, err := FindHoles(src, fInfo.Size())
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for _, hole := range append(holes, Extent{Offset: fInfo.Size()}) {
+		if hole.Offset > offset {
+			err = CopyRange(dst, src, offset, hole.Offset-offset)
+			if err != nil {
+				return err
+			}
+		}
+
+		offset = hole.Offset + hole.Size
+	}
+
+	return dst.Truncate(fInfo.Size())
+}
+
+// copyRange Copy size bytes at offset in src to the same offset in dst
+// through a buffer.
+func copyRange(dst *os.File, src *os.File, offset int64, size int64) error {
+	_, err := dst.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, io.NewSectionReader(src, offset, size))
+	return err
+}
@@ -0,0 +1,261 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testChecksum Checksum of content, as the sender would send it.
+func testChecksum(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "sum")
+	writeTestFile(t, path, content)
+
+	checksum, err := GetChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return checksum
+}
+
+// beginTestTransfer Begin a transfer of content to path in blocks of 4 bytes.
+func beginTestTransfer(t *testing.T, p *partialTransfers, path string, content string) *BeginTransferResponse {
+	resp, err := p.begin(&BeginTransferRequest{
+		Path:      path,
+		Checksum:  testChecksum(t, content),
+		Size:      int64(len(content)),
+		BlockSize: 4,
+	})
+
+	if err != nil {
+		t.Fatalf("begin failed: %s", err)
+	}
+
+	return resp
+}
+
+// commitTestTransfer Commit a transfer of content to path.
+func commitTestTransfer(t *testing.T, p *partialTransfers, path string, content string) error {
+	_, err := p.commit(&CommitTransferRequest{
+		Path:     path,
+		Checksum: testChecksum(t, content),
+		Size:     int64(len(content)),
+		Mode:     0644,
+	})
+
+	return err
+}
+
+// writeTestBlock Write block index of a transfer in blocks of 4 bytes.
+func writeTestBlock(t *testing.T, p *partialTransfers, path string, index int64, data string) {
+	transfer, err := p.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := transfer.writeBlock(index, index*4, []byte(data)); err != nil {
+		t.Fatalf("writeBlock failed: %s", err)
+	}
+}
+
+func TestPartialTransferResume(t *testing.T) {
+	enterTestTree(t)
+
+	p := newPartialTransfers()
+	if resp := beginTestTransfer(t, p, "f", "aaaabbbb"); resp.Resumed {
+		t.Fatalf("A new transfer was resumed")
+	}
+
+	writeTestBlock(t, p, "f", 1, "bbbb")
+
+	// The receiver goes away with a record half written.
+	transfer, _ := p.get("f")
+	transfer.blocks.Write([]byte{0, 0, 0})
+	transfer.close()
+
+	p = newPartialTransfers()
+	resp := beginTestTransfer(t, p, "f", "aaaabbbb")
+	if !resp.Resumed || !reflect.DeepEqual(resp.ReceivedBlocks, []int64{1}) {
+		t.Fatalf("begin = %+v, want block 1 resumed", resp)
+	}
+
+	writeTestBlock(t, p, "f", 0, "aaaa")
+
+	// Blocks logged after the record that was cut short are read back.
+	transfer, _ = p.get("f")
+	transfer.close()
+
+	p = newPartialTransfers()
+	resp = beginTestTransfer(t, p, "f", "aaaabbbb")
+	if !resp.Resumed || !reflect.DeepEqual(resp.ReceivedBlocks, []int64{0, 1}) {
+		t.Fatalf("begin = %+v, want blocks 0 and 1 resumed", resp)
+	}
+
+	if err := commitTestTransfer(t, p, "f", "aaaabbbb"); err != nil {
+		t.Fatalf("commit failed: %s", err)
+	}
+
+	if data, _ := ioutil.ReadFile("f"); string(data) != "aaaabbbb" {
+		t.Errorf("f is %q, want %q", data, "aaaabbbb")
+	}
+
+	if files, _ := ioutil.ReadDir(partialDir); len(files) != 0 {
+		t.Errorf("%d files were left in %s", len(files), partialDir)
+	}
+}
+
+func TestPartialTransferOtherVersionStartsOver(t *testing.T) {
+	enterTestTree(t)
+
+	p := newPartialTransfers()
+	beginTestTransfer(t, p, "f", "aaaabbbb")
+	writeTestBlock(t, p, "f", 1, "bbbb")
+
+	if resp := beginTestTransfer(t, p, "f", "aaaacccc"); resp.Resumed || len(resp.ReceivedBlocks) != 0 {
+		t.Errorf("begin of another version = %+v, want a new transfer", resp)
+	}
+}
+
+func TestPartialTransferStartsFromCurrentFile(t *testing.T) {
+	enterTestTree(t)
+	writeTestFile(t, "f", "aaaaxxxx")
+
+	// Only the block that differs is sent.
+	p := newPartialTransfers()
+	beginTestTransfer(t, p, "f", "aaaabbbb")
+	writeTestBlock(t, p, "f", 1, "bbbb")
+
+	if err := commitTestTransfer(t, p, "f", "aaaabbbb"); err != nil {
+		t.Fatalf("commit failed: %s", err)
+	}
+
+	if data, _ := ioutil.ReadFile("f"); string(data) != "aaaabbbb" {
+		t.Errorf("f is %q, want %q", data, "aaaabbbb")
+	}
+}
+
+func TestPartialTransferCommitMismatch(t *testing.T) {
+	enterTestTree(t)
+	writeTestFile(t, "f", "old")
+
+	p := newPartialTransfers()
+	beginTestTransfer(t, p, "f", "aaaabbbb")
+	writeTestBlock(t, p, "f", 0, "aaaa")
+	writeTestBlock(t, p, "f", 1, "cccc")
+
+	err := commitTestTransfer(t, p, "f", "aaaabbbb")
+	if status.Code(err) != codes.DataLoss {
+		t.Fatalf("commit = %v, want %s", err, codes.DataLoss)
+	}
+
+	if data, _ := ioutil.ReadFile("f"); string(data) != "old" {
+		t.Errorf("f was replaced with %q", data)
+	}
+
+	if _, err := p.get("f"); err == nil {
+		t.Errorf("The transfer that didn't match was kept")
+	}
+
+	if _, err := os.Stat(partialName("f") + ".data"); !os.IsNotExist(err) {
+		t.Errorf("The partial file that didn't match was kept")
+	}
+}
+
+func TestCopySparseKeepsHoles(t *testing.T) {
+	dir := t.TempDir()
+	size := int64(4 << 20)
+
+	src, err := os.Create(filepath.Join(dir, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	// Data at both ends with a hole in between.
+	for _, offset := range []int64{0, size - 4} {
+		if _, err := src.WriteAt([]byte("data"), offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := copySparse(dst, src); err != nil {
+		t.Fatalf("copySparse failed: %s", err)
+	}
+
+	want, _ := ioutil.ReadFile(src.Name())
+	got, _ := ioutil.ReadFile(dst.Name())
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Copy differs from the source")
+	}
+
+	srcHoles, err := FindHoles(src, size)
+	if err != nil || len(srcHoles) == 0 {
+		t.Skip("The filesystem doesn't report holes")
+	}
+
+	if dstHoles, err := FindHoles(dst, size); err != nil || len(dstHoles) == 0 {
+		t.Errorf("Copy has no holes, the source has %+v", srcHoles)
+	}
+}
+
+func TestPartialTransfersConcurrent(t *testing.T) {
+	enterTestTree(t)
+
+	p := newPartialTransfers()
+	content := "aaaabbbbcccc"
+	checksum := testChecksum(t, content)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(path string) {
+			defer wg.Done()
+
+			_, err := p.begin(&BeginTransferRequest{Path: path, Checksum: checksum, Size: int64(len(content)), BlockSize: 4})
+			if err != nil {
+				t.Errorf("begin of %s failed: %s", path, err)
+				return
+			}
+
+			transfer, err := p.get(path)
+			for index := int64(0); err == nil && index < 3; index++ {
+				err = transfer.writeBlock(index, index*4, []byte(content[index*4:index*4+4]))
+			}
+
+			if err == nil {
+				_, err = p.commit(&CommitTransferRequest{Path: path, Checksum: checksum, Size: int64(len(content)), Mode: 0644})
+			}
+
+			if err != nil {
+				t.Errorf("Transfer of %s failed: %s", path, err)
+			}
+		}(fmt.Sprintf("f%d", i))
+	}
+
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		if data, _ := ioutil.ReadFile(fmt.Sprintf("f%d", i)); string(data) != content {
+			t.Errorf("f%d is %q, want %q", i, data, content)
+		}
+	}
+}
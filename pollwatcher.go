@@ -0,0 +1,185 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileState What we know about a file from the last scan.
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+	Mode    os.FileMode
+}
+
+// PollWatcher monitors a directory for changes by periodically scanning it and
+// comparing the result to the previous scan. Used where inotify doesn't
+// deliver events, like network mounts and FUSE filesystems.
+type PollWatcher struct {
+	tm       *TransferManager
+	interval time.Duration
+	basePath string
+	state    map[string]fileState
+	done     chan struct{}
+}
+
+// NewPollWatcher Create new instance of PollWatcher.
+func NewPollWatcher(basePath string, transferManager *TransferManager, interval time.Duration) *PollWatcher {
+	return &PollWatcher{
+		tm:       transferManager,
+		interval: interval,
+		basePath: basePath,
+		done:     make(chan struct{}),
+	}
+}
+
+// scan Stat every file and directory in the tree.
+func (pw *PollWatcher) scan() map[string]fileState {
+	state := make(map[string]fileState)
+
+	filepath.Walk(pw.basePath, func(wPath string, info os.FileInfo, err error) error {
+		if err != nil || wPath == pw.basePath {
+			return nil
+		}
+
+		if pw.tm.Excluded(wPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		state[wPath] = fileState{
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Mode:    info.Mode(),
+		}
+
+		return nil
+	})
+
+	return state
+}
+
+// diff Queue the changes between the previous and the current scan.
+func (pw *PollWatcher) diff(previous map[string]fileState, current map[string]fileState) {
+	var created, removed []string
+
+	for path, cur := range current {
+		prev, ok := previous[path]
+		if !ok {
+			created = append(created, path)
+		} else if cur.Mode.IsDir() != prev.Mode.IsDir() {
+			// Changed between file and directory, the old one has to go
+			// before the new one can be created.
+			removed = append(removed, path)
+			created = append(created, path)
+		}
+	}
+
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+
+	// Sorted so parent directories are created before their content.
+	sort.Strings(created)
+	sort.Strings(removed)
+
+	// Deleting a directory removes everything in it, so we only need to
+	// delete the topmost path.
+	var lastRemoved string
+	for _, path := range removed {
+		if lastRemoved != "" && strings.HasPrefix(path, lastRemoved+"/") {
+			continue
+		}
+
+		pw.tm.Add(QueueItem{
+			Action: TmActionDelete,
+			Path:   path,
+			IsDir:  previous[path].Mode.IsDir(),
+		})
+		lastRemoved = path
+	}
+
+	for _, path := range created {
+		if current[path].Mode.IsDir() {
+			pw.tm.Add(QueueItem{
+				Action: TmActionMkdir,
+				Path:   path,
+				Mode:   uint32(current[path].Mode.Perm()),
+				IsDir:  true,
+			})
+		} else {
+			pw.tm.Add(QueueItem{
+				Action: TmActionWrite,
+				Path:   path,
+			})
+		}
+	}
+
+	for path, cur := range current {
+		prev, ok := previous[path]
+		if !ok || cur.Mode.IsDir() != prev.Mode.IsDir() {
+			continue
+		}
+
+		if !cur.Mode.IsDir() && (cur.Size != prev.Size || !cur.ModTime.Equal(prev.ModTime)) {
+			pw.tm.Add(QueueItem{
+				Action: TmActionWrite,
+				Path:   path,
+			})
+		} else if cur.Mode != prev.Mode {
+			pw.tm.Add(QueueItem{
+				Action: TmActionChmod,
+				Path:   path,
+				Mode:   uint32(cur.Mode),
+				IsDir:  cur.Mode.IsDir(),
+			})
+		}
+	}
+}
+
+// Start watching files.
+func (pw *PollWatcher) Start() error {
+	pw.state = pw.scan()
+
+	go func() {
+		ticker := time.NewTicker(pw.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				current := pw.scan()
+				pw.diff(pw.state, current)
+				pw.state = current
+
+			case <-pw.done:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Rescan Every scan compares the whole tree to the previous one, so paths
+// that are no longer excluded are picked up by the next scan anyway.
+func (pw *PollWatcher) Rescan() {
+}
+
+// Close stop watching.
+func (pw *PollWatcher) Close() error {
+	close(pw.done)
+	return nil
+}
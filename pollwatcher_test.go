@@ -0,0 +1,97 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPollWatcherDiff(t *testing.T) {
+	then := time.Unix(1600000000, 0)
+	now := then.Add(time.Second)
+
+	file := func(size int64, modTime time.Time) fileState {
+		return fileState{Size: size, ModTime: modTime, Mode: 0644}
+	}
+
+	dir := fileState{ModTime: then, Mode: os.ModeDir | 0755}
+
+	tests := []struct {
+		name     string
+		previous map[string]fileState
+		current  map[string]fileState
+		want     []QueueItem
+	}{
+		{
+			name:     "unchanged",
+			previous: map[string]fileState{"d": dir, "d/f": file(1, then)},
+			current:  map[string]fileState{"d": dir, "d/f": file(1, then)},
+		},
+		{
+			name:     "created directory comes before its content",
+			previous: map[string]fileState{},
+			current:  map[string]fileState{"d/f": file(1, then), "d": dir},
+			want: []QueueItem{
+				{Action: TmActionMkdir, Path: "d", Mode: 0755, IsDir: true},
+				{Action: TmActionWrite, Path: "d/f"},
+			},
+		},
+		{
+			name:     "modified file",
+			previous: map[string]fileState{"f": file(1, then)},
+			current:  map[string]fileState{"f": file(1, now)},
+			want:     []QueueItem{{Action: TmActionWrite, Path: "f"}},
+		},
+		{
+			name:     "changed mode",
+			previous: map[string]fileState{"f": file(1, then)},
+			current:  map[string]fileState{"f": {Size: 1, ModTime: then, Mode: 0600}},
+			want:     []QueueItem{{Action: TmActionChmod, Path: "f", Mode: 0600}},
+		},
+		{
+			name:     "only the topmost removed path is deleted",
+			previous: map[string]fileState{"d": dir, "d/f": file(1, then), "x": file(1, then)},
+			current:  map[string]fileState{},
+			want: []QueueItem{
+				{Action: TmActionDelete, Path: "d", IsDir: true},
+				{Action: TmActionDelete, Path: "x"},
+			},
+		},
+		{
+			name:     "file replaced by directory",
+			previous: map[string]fileState{"p": file(1, then)},
+			current:  map[string]fileState{"p": dir, "p/f": file(1, now)},
+			want: []QueueItem{
+				{Action: TmActionDelete, Path: "p"},
+				{Action: TmActionMkdir, Path: "p", Mode: 0755, IsDir: true},
+				{Action: TmActionWrite, Path: "p/f"},
+			},
+		},
+		{
+			name:     "directory replaced by file",
+			previous: map[string]fileState{"p": dir, "p/f": file(1, then)},
+			current:  map[string]fileState{"p": file(1, now)},
+			want: []QueueItem{
+				{Action: TmActionDelete, Path: "p", IsDir: true},
+				{Action: TmActionWrite, Path: "p"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTransferManager(NewSender(), "", nil, newJobMetrics("test"))
+			pw := NewPollWatcher("", tm, time.Second)
+			pw.diff(tt.previous, tt.current)
+
+			if !reflect.DeepEqual(tm.queue, tt.want) {
+				t.Errorf("diff() queued %+v, want %+v", tm.queue, tt.want)
+			}
+		})
+	}
+}
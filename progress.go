@@ -0,0 +1,360 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ProgressAuto Show a progress display when stderr is a terminal and log
+	// progress otherwise.
+	ProgressAuto = "auto"
+
+	// ProgressTTY Always show a progress display.
+	ProgressTTY = "tty"
+
+	// ProgressLog Log progress every progress interval.
+	ProgressLog = "log"
+
+	// ProgressOff Don't report progress.
+	ProgressOff = "off"
+)
+
+// progressRedraw How often the progress display is redrawn.
+const progressRedraw = 200 * time.Millisecond
+
+// jobProgress Progress of a job at one point in time.
+type jobProgress struct {
+	job      *Job
+	progress QueueProgress
+	rate     float64
+}
+
+// rateWindow How far back the rate of a job is measured.
+const rateWindow = 5 * time.Second
+
+// rateSample Bytes done at one point in time.
+type rateSample struct {
+	bytes int64
+	at    time.Time
+}
+
+// transferRate Rate of a transfer over the last rateWindow, so the ETA
+// follows changes in speed without jumping around.
+type transferRate struct {
+	samples []rateSample
+}
+
+// update Add a sample of bytes done so far and get the rate in bytes per
+// second.
+func (r *transferRate) update(bytes int64, now time.Time) float64 {
+	// A new batch was started.
+	if len(r.samples) > 0 && bytes < r.samples[len(r.samples)-1].bytes {
+		r.samples = nil
+	}
+
+	r.samples = append(r.samples, rateSample{bytes: bytes, at: now})
+
+	for len(r.samples) > 2 && now.Sub(r.samples[1].at) >= rateWindow {
+		r.samples = r.samples[1:]
+	}
+
+	first := r.samples[0]
+	elapsed := now.Sub(first.at).Seconds()
+	if elapsed < 1 {
+		return 0
+	}
+
+	return float64(bytes-first.bytes) / elapsed
+}
+
+// ProgressReporter Reports how far the jobs have come with their transfers,
+// either as a display on the terminal that is redrawn in place or as log
+// entries every interval.
+type ProgressReporter struct {
+	jobs     func() []*Job
+	tty      bool
+	interval time.Duration
+	out      *os.File
+	rates    map[*Job]*transferRate
+
+	// Lines of the display on the terminal now.
+	lines int
+	mtx   sync.Mutex
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewProgressReporter Create new instance of ProgressReporter. With mode auto the display is used when stderr
+// is a terminal and logs are written as text. Returns nil if mode is off, or
+// if progress would be logged and interval is 0.
+func NewProgressReporter(mode string, interval time.Duration) (*ProgressReporter, error) {
+	tty := false
+
+	switch mode {
+	case ProgressAuto:
+		tty = isTerminal(os.Stderr) && logger.Format() == LogFormatText
+	case ProgressTTY:
+		tty = true
+	case ProgressLog:
+	case ProgressOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Unknown progress mode '%s', supported modes are %s, %s, %s and %s",
+			mode, ProgressAuto, ProgressTTY, ProgressLog, ProgressOff)
+	}
+
+	if !tty && interval <= 0 {
+		return nil, nil
+	}
+
+	return &ProgressReporter{
+		tty:      tty,
+		interval: interval,
+		out:      os.Stderr,
+		rates:    make(map[*Job]*transferRate),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}, nil
+}
+
+// isTerminal Check if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fInfo, err := f.Stat()
+	return err == nil && fInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// Start reporting on the jobs returned by jobs in the background.
+func (p *ProgressReporter) Start(jobs func() []*Job) {
+	p.jobs = jobs
+
+	interval := p.interval
+	if p.tty {
+		interval = progressRedraw
+
+		// Log entries have to go through us, so they don't end up in the
+		// middle of the display.
+		logger.SetOutput(p)
+	}
+
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.report()
+			}
+		}
+	}()
+}
+
+// Stop reporting and remove the display from the terminal.
+func (p *ProgressReporter) Stop() {
+	close(p.done)
+	<-p.stopped
+
+	if p.tty {
+		logger.SetOutput(p.out)
+
+		p.mtx.Lock()
+		p.clear()
+		p.mtx.Unlock()
+	}
+}
+
+// Write a log entry above the display.
+func (p *ProgressReporter) Write(b []byte) (int, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	// The display is drawn again on the next redraw.
+	p.clear()
+	return p.out.Write(b)
+}
+
+// report Sample the progress of the jobs and report it.
+func (p *ProgressReporter) report() {
+	now := time.Now()
+	rates := make(map[*Job]*transferRate)
+
+	var active []jobProgress
+
+	// Progress is sampled without holding mtx, the transfer managers may be
+	// waiting on it to log while holding their own locks.
+	for _, job := range p.jobs() {
+		progress := job.Progress()
+		if progress.ItemsTotal == 0 {
+			continue
+		}
+
+		rate, ok := p.rates[job]
+		if !ok {
+			rate = &transferRate{}
+		}
+
+		rates[job] = rate
+
+		active = append(active, jobProgress{
+			job:      job,
+			progress: progress,
+			rate:     rate.update(progress.BytesDone, now),
+		})
+	}
+
+	p.rates = rates
+
+	if p.tty {
+		p.draw(active)
+		return
+	}
+
+	for _, jp := range active {
+		p.log(jp)
+	}
+}
+
+// log Write the progress of a job as a log entry.
+func (p *ProgressReporter) log(jp jobProgress) {
+	progress := jp.progress
+
+	fields := Fields{
+		"files_done":  progress.ItemsDone,
+		"files_total": progress.ItemsTotal,
+		"bytes_done":  progress.BytesDone,
+		"bytes_total": progress.BytesTotal,
+		"rate":        int64(jp.rate),
+	}
+
+	if eta, ok := estimate(progress.BytesTotal-progress.BytesDone, jp.rate); ok {
+		fields["eta"] = eta
+	}
+
+	if current := progress.Current; current != nil {
+		fields["path"] = current.Path
+		fields["blocks_done"] = current.BlocksDone
+		fields["blocks_total"] = current.BlocksTotal
+		fields["file_bytes_done"] = current.BytesDone
+		fields["file_bytes_total"] = current.BytesTotal
+	}
+
+	jp.job.logger.Info("Progress", fields)
+}
+
+// draw Redraw the display with one line per active job and one for the file
+// it is sending.
+func (p *ProgressReporter) draw(active []jobProgress) {
+	var lines []string
+
+	for _, jp := range active {
+		progress := jp.progress
+
+		line := fmt.Sprintf("%s  %d/%d files  %s/%s  %s  %s/s",
+			jp.job.Name(), progress.ItemsDone, progress.ItemsTotal,
+			formatBytes(progress.BytesDone), formatBytes(progress.BytesTotal),
+			formatPercent(progress.BytesDone, progress.BytesTotal), formatBytes(int64(jp.rate)))
+
+		if eta, ok := estimate(progress.BytesTotal-progress.BytesDone, jp.rate); ok {
+			line += fmt.Sprintf("  ETA %s", eta)
+		}
+
+		lines = append(lines, line)
+
+		if current := progress.Current; current != nil {
+			line := fmt.Sprintf("  %s  %d/%d blocks  %s/%s  %s",
+				shortenPath(current.Path, 40), current.BlocksDone, current.BlocksTotal,
+				formatBytes(current.BytesDone), formatBytes(current.BytesTotal),
+				formatPercent(current.BytesDone, current.BytesTotal))
+
+			elapsed := time.Since(current.Started).Seconds()
+			if elapsed > 0 && current.BytesDone > 0 {
+				rate := float64(current.BytesDone) / elapsed
+				line += fmt.Sprintf("  %s/s", formatBytes(int64(rate)))
+
+				if eta, ok := estimate(current.BytesTotal-current.BytesDone, rate); ok {
+					line += fmt.Sprintf("  ETA %s", eta)
+				}
+			}
+
+			lines = append(lines, line)
+		}
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.clear()
+	for _, line := range lines {
+		fmt.Fprintln(p.out, line)
+	}
+
+	p.lines = len(lines)
+}
+
+// clear Remove the display from the terminal. Has to be called with mtx held.
+func (p *ProgressReporter) clear() {
+	if p.lines > 0 {
+		fmt.Fprint(p.out, strings.Repeat("\033[1A\033[2K", p.lines), "\r")
+	}
+
+	p.lines = 0
+}
+
+// estimate Time left to transfer remaining bytes at rate bytes per second.
+func estimate(remaining int64, rate float64) (time.Duration, bool) {
+	if rate <= 0 || remaining < 0 {
+		return 0, false
+	}
+
+	seconds := float64(remaining) / rate
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second), true
+}
+
+// formatPercent Format done out of total as a percentage.
+func formatPercent(done, total int64) string {
+	if total <= 0 {
+		return "100%"
+	}
+
+	return fmt.Sprintf("%d%%", done*100/total)
+}
+
+// formatBytes Format a number of bytes with a binary unit, like 1.5 GiB.
+func formatBytes(bytes int64) string {
+	const unit = 1024
+
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// shortenPath Shorten path to at most max characters by cutting from the
+// start, the file name is the interesting part.
+func shortenPath(path string, max int) string {
+	if len(path) <= max {
+		return path
+	}
+
+	return "..." + path[len(path)-max+3:]
+}
@@ -0,0 +1,160 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ProtocolVersion Version of ReceiverService we speak. Bumped when a
+	// change can't be negotiated with a feature flag.
+	ProtocolVersion = 2
+
+	// MinProtocolVersion Oldest version of ReceiverService we still speak.
+	// Version 1 is receivers from before the Hello handshake.
+	MinProtocolVersion = 1
+)
+
+const (
+	// FeatureSparse Holes can be punched with PunchHole.
+	FeatureSparse = "sparse"
+
+	// FeatureListTree The tree can be listed with ListTree.
+	FeatureListTree = "list-tree"
+
+	// FeatureResumable Files are transferred with BeginTransfer and
+	// CommitTransfer, and interrupted transfers can be resumed.
+	FeatureResumable = "resumable"
+)
+
+// Hash algorithms and compression codecs in order of preference.
+var (
+	hashAlgorithms    = []string{"md5"}
+	compressionCodecs = []string{"none"}
+	features          = []string{FeatureSparse, FeatureListTree, FeatureResumable}
+)
+
+// Capabilities What was agreed on with the other end in the handshake.
+type Capabilities struct {
+	ProtocolVersion uint32
+	Version         string
+	HashAlgorithm   string
+	Compression     string
+	Features        map[string]bool
+}
+
+// Has Check if both ends support feature.
+func (c *Capabilities) Has(feature string) bool {
+	return c.Features[feature]
+}
+
+// legacyCapabilities What a receiver from before the handshake supports.
+func legacyCapabilities() *Capabilities {
+	return &Capabilities{
+		ProtocolVersion: 1,
+		Version:         "unknown",
+		HashAlgorithm:   "md5",
+		Compression:     "none",
+		Features:        map[string]bool{},
+	}
+}
+
+// newHelloRequest Describe what we support.
+func newHelloRequest() *HelloRequest {
+	return &HelloRequest{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		Version:            version,
+		HashAlgorithms:     hashAlgorithms,
+		CompressionCodecs:  compressionCodecs,
+		Features:           features,
+	}
+}
+
+// newHelloResponse Describe what we support, in reply to a HelloRequest.
+func newHelloResponse() *HelloResponse {
+	req := newHelloRequest()
+
+	return &HelloResponse{
+		ProtocolVersion:    req.ProtocolVersion,
+		MinProtocolVersion: req.MinProtocolVersion,
+		Version:            req.Version,
+		HashAlgorithms:     req.HashAlgorithms,
+		CompressionCodecs:  req.CompressionCodecs,
+		Features:           req.Features,
+	}
+}
+
+// checkProtocolVersion Check that we can speak the protocol of the other
+// end, which speaks version and accepts down to minVersion.
+func checkProtocolVersion(version, minVersion uint32) error {
+	if version < MinProtocolVersion {
+		return fmt.Errorf("Protocol version %d is too old, at least %d is needed", version, MinProtocolVersion)
+	}
+
+	if minVersion > ProtocolVersion {
+		return fmt.Errorf("Protocol version %d is too old for the other end, it needs at least %d", ProtocolVersion, minVersion)
+	}
+
+	return nil
+}
+
+// negotiate Agree on what to use with a receiver that replied with resp.
+func negotiate(resp *HelloResponse) (*Capabilities, error) {
+	err := checkProtocolVersion(resp.GetProtocolVersion(), resp.GetMinProtocolVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	hashAlgorithm, ok := pickFirst(hashAlgorithms, resp.GetHashAlgorithms())
+	if !ok {
+		return nil, fmt.Errorf("No hash algorithm in common, we support %s and the receiver %s",
+			strings.Join(hashAlgorithms, ", "), strings.Join(resp.GetHashAlgorithms(), ", "))
+	}
+
+	compression, ok := pickFirst(compressionCodecs, resp.GetCompressionCodecs())
+	if !ok {
+		return nil, fmt.Errorf("No compression codec in common, we support %s and the receiver %s",
+			strings.Join(compressionCodecs, ", "), strings.Join(resp.GetCompressionCodecs(), ", "))
+	}
+
+	caps := &Capabilities{
+		ProtocolVersion: resp.GetProtocolVersion(),
+		Version:         resp.GetVersion(),
+		HashAlgorithm:   hashAlgorithm,
+		Compression:     compression,
+		Features:        make(map[string]bool),
+	}
+
+	// Newer than us, so we speak our version.
+	if caps.ProtocolVersion > ProtocolVersion {
+		caps.ProtocolVersion = ProtocolVersion
+	}
+
+	for _, feature := range resp.GetFeatures() {
+		for _, ours := range features {
+			if feature == ours {
+				caps.Features[feature] = true
+			}
+		}
+	}
+
+	return caps, nil
+}
+
+// pickFirst Get the first of ours that is also in theirs.
+func pickFirst(ours, theirs []string) (string, bool) {
+	for _, o := range ours {
+		for _, t := range theirs {
+			if o == t {
+				return o, true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,138 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import "testing"
+
+func TestCheckProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    uint32
+		minVersion uint32
+		wantErr    bool
+	}{
+		{"same version", ProtocolVersion, MinProtocolVersion, false},
+		{"oldest we speak", MinProtocolVersion, MinProtocolVersion, false},
+		{"newer that accepts ours", ProtocolVersion + 1, ProtocolVersion, false},
+		{"newer that accepts older", ProtocolVersion + 5, MinProtocolVersion, false},
+		{"older than we speak", MinProtocolVersion - 1, 0, true},
+		{"newer that needs a newer one", ProtocolVersion + 1, ProtocolVersion + 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkProtocolVersion(test.version, test.minVersion)
+			if test.wantErr && err == nil {
+				t.Errorf("checkProtocolVersion(%d, %d) didn't fail", test.version, test.minVersion)
+			} else if !test.wantErr && err != nil {
+				t.Errorf("checkProtocolVersion(%d, %d) failed: %s", test.version, test.minVersion, err)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name         string
+		resp         *HelloResponse
+		wantErr      bool
+		wantProtocol uint32
+		wantFeatures []string
+	}{
+		{
+			name:         "same as us",
+			resp:         newHelloResponse(),
+			wantProtocol: ProtocolVersion,
+			wantFeatures: features,
+		},
+		{
+			name: "newer receiver",
+			resp: &HelloResponse{
+				ProtocolVersion:    ProtocolVersion + 1,
+				MinProtocolVersion: MinProtocolVersion,
+				HashAlgorithms:     []string{"blake3", "md5"},
+				CompressionCodecs:  []string{"zstd", "none"},
+				Features:           []string{FeatureSparse, "something-new"},
+			},
+			wantProtocol: ProtocolVersion,
+			wantFeatures: []string{FeatureSparse},
+		},
+		{
+			name: "oldest receiver",
+			resp: &HelloResponse{
+				ProtocolVersion:    MinProtocolVersion,
+				MinProtocolVersion: MinProtocolVersion,
+				HashAlgorithms:     []string{"md5"},
+				CompressionCodecs:  []string{"none"},
+			},
+			wantProtocol: MinProtocolVersion,
+		},
+		{
+			name: "receiver needs a newer protocol",
+			resp: &HelloResponse{
+				ProtocolVersion:    ProtocolVersion + 2,
+				MinProtocolVersion: ProtocolVersion + 1,
+				HashAlgorithms:     []string{"md5"},
+				CompressionCodecs:  []string{"none"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no hash algorithm in common",
+			resp: &HelloResponse{
+				ProtocolVersion:    ProtocolVersion,
+				MinProtocolVersion: MinProtocolVersion,
+				HashAlgorithms:     []string{"sha256"},
+				CompressionCodecs:  []string{"none"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no compression codec in common",
+			resp: &HelloResponse{
+				ProtocolVersion:    ProtocolVersion,
+				MinProtocolVersion: MinProtocolVersion,
+				HashAlgorithms:     []string{"md5"},
+				CompressionCodecs:  []string{"zstd"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			caps, err := negotiate(test.resp)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("negotiate didn't fail, got %+v", caps)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("negotiate failed: %s", err)
+			}
+
+			if caps.ProtocolVersion != test.wantProtocol {
+				t.Errorf("ProtocolVersion = %d, want %d", caps.ProtocolVersion, test.wantProtocol)
+			}
+
+			if caps.HashAlgorithm != "md5" || caps.Compression != "none" {
+				t.Errorf("Picked %s and %s, want md5 and none", caps.HashAlgorithm, caps.Compression)
+			}
+
+			if len(caps.Features) != len(test.wantFeatures) {
+				t.Errorf("Features = %v, want %v", caps.Features, test.wantFeatures)
+			}
+
+			for _, feature := range test.wantFeatures {
+				if !caps.Has(feature) {
+					t.Errorf("Features = %v, missing %s", caps.Features, feature)
+				}
+			}
+		})
+	}
+}
@@ -6,23 +6,57 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"os"
+	"path"
+	"syscall"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 // Receiver implementation of fileserver.
 type Receiver struct {
 	listener *net.Listener
 	grpcSrv  *grpc.Server
+	health   *health.Server
+	partials *partialTransfers
+	done     chan struct{}
+
+	// Reflection Register the server reflection service, for tools like
+	// grpcurl.
+	Reflection bool
+
+	// HealthInterval How often the target directory is checked for the
+	// health service.
+	HealthInterval time.Duration
+
+	// PartialMaxAge How long a partial transfer is kept for the sender to
+	// resume it.
+	PartialMaxAge time.Duration
+
+	// MinFreeSpace Report not serving when no more than this many bytes are
+	// free on the target filesystem.
+	MinFreeSpace int64
 }
 
 // NewReceiver Create a new Receiver instance.
 func NewReceiver() *Receiver {
-	return &Receiver{}
+	return &Receiver{
+		health:         health.NewServer(),
+		partials:       newPartialTransfers(),
+		done:           make(chan struct{}),
+		HealthInterval: 10 * time.Second,
+		PartialMaxAge:  24 * time.Hour,
+	}
 }
 
 // Start receiver.
@@ -33,7 +67,10 @@ func (r *Receiver) Start(address string) error {
 		return fmt.Errorf("Failed to listen: %s", err.Error())
 	}
 
-	grpcSrv := grpc.NewServer()
+	grpcSrv := grpc.NewServer(
+		grpc.UnaryInterceptor(logUnaryRPC),
+		grpc.StreamInterceptor(logStreamRPC),
+	)
 
 	if err != nil {
 		return fmt.Errorf("Failed to start gRPC server: %s", err.Error())
@@ -42,19 +79,172 @@ func (r *Receiver) Start(address string) error {
 	r.listener = &listener
 	r.grpcSrv = grpcSrv
 
-	RegisterReceiverServiceServer(grpcSrv, &Receiver{})
-	err = grpcSrv.Serve(listener)
+	RegisterReceiverServiceServer(grpcSrv, r)
+	healthpb.RegisterHealthServer(grpcSrv, r.health)
 
-	log.Printf("Listening on %s\n", address)
+	if r.Reflection {
+		reflection.Register(grpcSrv)
+	}
 
-	return nil
+	go r.watchHealth(r.HealthInterval, r.done)
+	go r.cleanPartials(r.done)
+
+	logger.Info("Listening", Fields{"address": listener.Addr().String()})
+
+	// Returns nil once Stop has been called.
+	return grpcSrv.Serve(listener)
+}
+
+// Stop Stop accepting connections and wait for the RPCs in flight to finish.
+// If they take longer than timeout they are cancelled.
+func (r *Receiver) Stop(timeout time.Duration) {
+	if r.grpcSrv == nil {
+		return
+	}
+
+	// Health checks see us going away before the connections do.
+	close(r.done)
+	r.health.Shutdown()
+
+	stopped := make(chan struct{})
+
+	go func() {
+		r.grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		logger.Warn("RPCs still running, cancelling them", Fields{"timeout": timeout})
+		r.grpcSrv.Stop()
+	}
+}
+
+// fileError Give errors from the filesystem a status code, so the sender
+// can tell a missing file, missing permissions and a full disk apart from
+// other failures.
+func fileError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return status.Error(codes.NotFound, err.Error())
+	case os.IsPermission(err):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, syscall.ENOSPC):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	return err
+}
+
+// fileErrorf Like fileError, with what was being done in front of the
+// message.
+func fileErrorf(err error, format string, args ...interface{}) error {
+	return status.Errorf(status.Code(fileError(err)), "%s: %s", fmt.Sprintf(format, args...), err.Error())
+}
+
+// rpcFields Fields describing a call, for logging.
+func rpcFields(ctx context.Context, method string, req interface{}, start time.Time) Fields {
+	fields := Fields{
+		"method":   path.Base(method),
+		"duration": time.Since(start),
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["peer"] = p.Addr.String()
+	}
+
+	switch r := req.(type) {
+	case *RenameRequest:
+		fields["path"] = r.GetOldPath()
+		fields["to"] = r.GetNewPath()
+	case *WriteFileBlockRequest:
+		fields["path"] = r.GetFilePath()
+		fields["bytes"] = len(r.GetData())
+	case interface{ GetPath() string }:
+		fields["path"] = r.GetPath()
+	}
+
+	return fields
+}
+
+// logUnaryRPC Log every failed call with its cause, and all calls at debug
+// level.
+func logUnaryRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	receiverRPCs.WithLabelValues(path.Base(info.FullMethod), status.Code(err).String()).Inc()
+	if w, ok := req.(*WriteFileBlockRequest); ok && err == nil {
+		receiverBytesWritten.Add(float64(len(w.GetData())))
+	}
+
+	fields := rpcFields(ctx, info.FullMethod, req, start)
+	if status.Code(err) == codes.NotFound {
+		// Expected when asking about files the sender hasn't sent yet.
+		fields["error"] = err
+		logger.Debug("RPC", fields)
+	} else if err != nil {
+		fields["error"] = err
+		logger.Error("RPC failed", fields)
+	} else {
+		logger.Debug("RPC", fields)
+	}
+
+	return resp, err
+}
+
+// logStreamRPC Same as logUnaryRPC for streaming calls.
+func logStreamRPC(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+
+	receiverRPCs.WithLabelValues(path.Base(info.FullMethod), status.Code(err).String()).Inc()
+
+	fields := rpcFields(stream.Context(), info.FullMethod, nil, start)
+	if status.Code(err) == codes.Canceled {
+		// Streams like health watches end when the client goes away.
+		fields["error"] = err
+		logger.Debug("RPC", fields)
+	} else if err != nil {
+		fields["error"] = err
+		logger.Error("RPC failed", fields)
+	} else {
+		logger.Debug("RPC", fields)
+	}
+
+	return err
+}
+
+// Hello (RPC) Tell the sender what we support. Senders speaking a protocol
+// we can't are refused.
+func (r *Receiver) Hello(ctx context.Context, req *HelloRequest) (*HelloResponse, error) {
+	err := checkProtocolVersion(req.GetProtocolVersion(), req.GetMinProtocolVersion())
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	fields := Fields{
+		"version":  req.GetVersion(),
+		"protocol": req.GetProtocolVersion(),
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["peer"] = p.Addr.String()
+	}
+
+	logger.Info("Sender connected", fields)
+
+	return newHelloResponse(), nil
 }
 
 // GetFileChecksum (RPC) Get MD5 checksum of a file.
 func (r *Receiver) GetFileChecksum(ctx context.Context, req *FileRequest) (*FileChecksumResponse, error) {
 	checkSum, err := GetChecksum(req.GetPath())
 	if err != nil {
-		return &FileChecksumResponse{}, err
+		return &FileChecksumResponse{}, fileError(err)
 	}
 
 	return &FileChecksumResponse{
@@ -66,13 +256,13 @@ func (r *Receiver) GetFileChecksum(ctx context.Context, req *FileRequest) (*File
 func (r *Receiver) Rename(ctx context.Context, req *RenameRequest) (*EmptyResponse, error) {
 	err := os.Rename(req.GetOldPath(), req.GetNewPath())
 
-	return &EmptyResponse{}, err
+	return &EmptyResponse{}, fileError(err)
 }
 
 // Delete (RPC) Delete a file or directory.
 func (r *Receiver) Delete(ctx context.Context, req *FileRequest) (*EmptyResponse, error) {
 	err := os.RemoveAll(req.Path)
-	return &EmptyResponse{}, err
+	return &EmptyResponse{}, fileError(err)
 }
 
 // Touch (RPC) Create a file if it doesn't exist and set correct permissions.
@@ -81,11 +271,11 @@ func (r *Receiver) Touch(ctx context.Context, req *FileRequest) (*EmptyResponse,
 
 	if err != nil && os.IsNotExist(err) {
 		fh, err := os.Create(req.GetPath())
-		fh.Close()
-
 		if err != nil {
-			return &EmptyResponse{}, err
+			return &EmptyResponse{}, fileError(err)
 		}
+
+		fh.Close()
 	}
 
 	return &EmptyResponse{}, nil
@@ -94,24 +284,91 @@ func (r *Receiver) Touch(ctx context.Context, req *FileRequest) (*EmptyResponse,
 // Chmod (RPC) Chmod a file or directory.
 func (r *Receiver) Chmod(ctx context.Context, req *FileRequest) (*EmptyResponse, error) {
 	err := os.Chmod(req.GetPath(), os.FileMode(req.GetMode()))
-	return &EmptyResponse{}, err
+	return &EmptyResponse{}, fileError(err)
+}
+
+// cleanPartials Remove abandoned partial transfers every hour, until done is
+// closed.
+func (r *Receiver) cleanPartials(done chan struct{}) {
+	for {
+		r.partials.clean(r.PartialMaxAge)
+
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
+
+// BeginTransfer (RPC) Start transferring a file into a partial file, or
+// resume an earlier transfer of the same version of it.
+func (r *Receiver) BeginTransfer(ctx context.Context, req *BeginTransferRequest) (*BeginTransferResponse, error) {
+	return r.partials.begin(req)
+}
+
+// CommitTransfer (RPC) Replace a file with its completed transfer, and
+// report the checksum it ended up with.
+func (r *Receiver) CommitTransfer(ctx context.Context, req *CommitTransferRequest) (*CommitTransferResponse, error) {
+	checksum, err := r.partials.commit(req)
+	if err != nil {
+		return &CommitTransferResponse{}, err
+	}
+
+	return &CommitTransferResponse{Checksum: checksum}, nil
 }
 
 // WriteFileBlock (RPC) Write a chunk of data to a file.
 func (r *Receiver) WriteFileBlock(ctx context.Context, req *WriteFileBlockRequest) (*EmptyResponse, error) {
+	if req.GetPartial() {
+		t, err := r.partials.get(req.GetFilePath())
+		if err != nil {
+			return &EmptyResponse{}, err
+		}
+
+		return &EmptyResponse{}, t.writeBlock(req.GetIndex(), req.GetOffset(), req.GetData())
+	}
+
 	// TODO: We should cache the filedescriptor and don't reopen it between each call.
 	fh, err := os.OpenFile(req.GetFilePath(), os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening %s: %s\n", req.GetFilePath(), err.Error())
-		return &EmptyResponse{}, err
+		return &EmptyResponse{}, fileErrorf(err, "Failed to open %s", req.GetFilePath())
 	}
 
 	defer fh.Close()
 
 	_, err = fh.WriteAt(req.GetData(), req.GetOffset())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing %d bytes to %s @ offset %d: %s\n", req.GetSize(), req.GetFilePath(), req.GetOffset(), err.Error())
-		return &EmptyResponse{}, err
+		return &EmptyResponse{}, fileErrorf(err, "Failed to write %d bytes to %s @ offset %d", req.GetSize(), req.GetFilePath(), req.GetOffset())
+	}
+
+	return &EmptyResponse{}, nil
+}
+
+// PunchHole (RPC) Deallocate a range of a file so it stays sparse.
+func (r *Receiver) PunchHole(ctx context.Context, req *PunchHoleRequest) (*EmptyResponse, error) {
+	if req.GetPartial() {
+		t, err := r.partials.get(req.GetPath())
+		if err != nil {
+			return &EmptyResponse{}, err
+		}
+
+		return &EmptyResponse{}, t.punchHole(req.GetIndex(), req.GetOffset(), req.GetSize())
+	}
+
+	fh, err := os.OpenFile(req.GetPath(), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return &EmptyResponse{}, fileErrorf(err, "Failed to open %s", req.GetPath())
+	}
+
+	defer fh.Close()
+
+	// Fall back to writing zeroes if the filesystem can't punch holes.
+	if err := PunchHole(fh, req.GetOffset(), req.GetSize()); err != nil {
+		_, err = fh.WriteAt(make([]byte, req.GetSize()), req.GetOffset())
+		if err != nil {
+			return &EmptyResponse{}, fileErrorf(err, "Failed to zero %d bytes in %s @ offset %d", req.GetSize(), req.GetPath(), req.GetOffset())
+		}
 	}
 
 	return &EmptyResponse{}, nil
@@ -119,7 +376,11 @@ func (r *Receiver) WriteFileBlock(ctx context.Context, req *WriteFileBlockReques
 
 // TruncateFile (RPC) Truncate file at given size.
 func (r *Receiver) TruncateFile(ctx context.Context, req *TruncateFileRequest) (*EmptyResponse, error) {
-	os.Truncate(req.GetPath(), req.GetSize())
+	err := os.Truncate(req.GetPath(), req.GetSize())
+	if err != nil {
+		return &EmptyResponse{}, fileErrorf(err, "Failed to truncate %s at %d bytes", req.GetPath(), req.GetSize())
+	}
+
 	return &EmptyResponse{}, nil
 }
 
@@ -127,7 +388,7 @@ func (r *Receiver) TruncateFile(ctx context.Context, req *TruncateFileRequest) (
 func (r *Receiver) GetFileMeta(ctx context.Context, req *FileRequest) (*FileResponse, error) {
 	f, err := ReadFile(req.GetPath(), req.GetBlockSize())
 	if err != nil {
-		return &FileResponse{}, err
+		return &FileResponse{}, fileError(err)
 	}
 
 	defer f.Close()
@@ -156,8 +417,8 @@ func (r *Receiver) GetFileMeta(ctx context.Context, req *FileRequest) (*FileResp
 }
 
 // GetRemoteFileMeta (RPC) Marshals the response from GetFileMeta into a FileMeta object.
-func GetRemoteFileMeta(client ReceiverServiceClient, filePath string, blockSize int64) (*FileMeta, error) {
-	resp, err := client.GetFileMeta(context.Background(), &FileRequest{
+func GetRemoteFileMeta(ctx context.Context, client ReceiverServiceClient, filePath string, blockSize int64) (*FileMeta, error) {
+	resp, err := client.GetFileMeta(ctx, &FileRequest{
 		Path:      filePath,
 		BlockSize: blockSize,
 	})
@@ -187,8 +448,28 @@ func GetRemoteFileMeta(client ReceiverServiceClient, filePath string, blockSize
 	}, nil
 }
 
+// ListTree (RPC) Stream all files and directories in the target path.
+func (r *Receiver) ListTree(req *ListTreeRequest, stream ReceiverService_ListTreeServer) error {
+	entries, err := ListTree(".", req.GetWithChecksums())
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if isPartialPath(entry.GetPath()) {
+			continue
+		}
+
+		if err := stream.Send(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // CreateDirectory (RPC) Create a directory.
 func (r *Receiver) CreateDirectory(ctx context.Context, req *FileRequest) (*EmptyResponse, error) {
 	err := os.MkdirAll(req.GetPath(), os.FileMode(req.GetMode()))
-	return &EmptyResponse{}, err
+	return &EmptyResponse{}, fileError(err)
 }
@@ -0,0 +1,368 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// DriftMissing Path exists locally but not on the remote.
+	DriftMissing = "missing"
+
+	// DriftChanged File content differs between local and remote.
+	DriftChanged = "changed"
+
+	// DriftMode Permissions differ between local and remote.
+	DriftMode = "mode"
+
+	// DriftExtra Path exists on the remote but not locally.
+	DriftExtra = "extra"
+
+	// DriftRenamed File exists on the remote under another name.
+	DriftRenamed = "renamed"
+)
+
+// Drift A single difference between the local tree and the remote.
+type Drift struct {
+	Kind  string
+	Path  string
+	IsDir bool
+	Mode  uint32
+
+	// Path on the remote for renamed files.
+	OldPath string
+}
+
+// DriftReport Differences found between the local tree and the remote.
+type DriftReport struct {
+	Items []Drift
+}
+
+// Count Number of differences of the given kind.
+func (r *DriftReport) Count(kind string) int {
+	n := 0
+	for _, item := range r.Items {
+		if item.Kind == kind {
+			n++
+		}
+	}
+
+	return n
+}
+
+// String Summary of the report.
+func (r *DriftReport) String() string {
+	return fmt.Sprintf("%d missing, %d changed, %d mode, %d renamed, %d extra",
+		r.Count(DriftMissing), r.Count(DriftChanged), r.Count(DriftMode), r.Count(DriftRenamed), r.Count(DriftExtra))
+}
+
+// CompareTree Find the differences between the local and the remote tree.
+// Checksums are only compared when both sides have them, and are also used to
+// recognize files that were renamed. Items are ordered so that they can be
+// applied to the remote in sequence.
+func CompareTree(local []*TreeEntry, remote []*TreeEntry) *DriftReport {
+	report := &DriftReport{}
+	remoteEntries := make(map[string]*TreeEntry)
+	localEntries := make(map[string]*TreeEntry)
+
+	for _, entry := range remote {
+		remoteEntries[entry.GetPath()] = entry
+	}
+
+	for _, entry := range local {
+		localEntries[entry.GetPath()] = entry
+	}
+
+	// Sorted so parent directories come before their content.
+	sort.Slice(local, func(i, j int) bool { return local[i].GetPath() < local[j].GetPath() })
+
+	var extra []string
+	for path := range remoteEntries {
+		if _, ok := localEntries[path]; !ok {
+			extra = append(extra, path)
+		}
+	}
+
+	sort.Strings(extra)
+
+	// Deleting a directory removes everything in it, so we only report the
+	// topmost path.
+	deleted := make(map[string]bool)
+	isDeleted := func(path string) bool {
+		for dir := filepath.Dir(path); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			if deleted[dir] {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	addExtra := func(path string) {
+		if isDeleted(path) {
+			return
+		}
+
+		deleted[path] = true
+		report.Items = append(report.Items, Drift{
+			Kind:  DriftExtra,
+			Path:  path,
+			IsDir: remoteEntries[path].GetIsDir(),
+		})
+	}
+
+	// Paths that changed between file and directory have to go first.
+	for _, lEntry := range local {
+		rEntry, ok := remoteEntries[lEntry.GetPath()]
+		if ok && rEntry.GetIsDir() != lEntry.GetIsDir() {
+			addExtra(lEntry.GetPath())
+		}
+	}
+
+	// Then directories, so renamed and new files have somewhere to go.
+	for _, lEntry := range local {
+		rEntry, ok := remoteEntries[lEntry.GetPath()]
+		if lEntry.GetIsDir() && (!ok || !rEntry.GetIsDir()) {
+			report.Items = append(report.Items, Drift{
+				Kind:  DriftMissing,
+				Path:  lEntry.GetPath(),
+				IsDir: true,
+				Mode:  lEntry.GetMode(),
+			})
+		}
+	}
+
+	// A file missing here with the same content as a file that only exists
+	// on the remote was renamed.
+	renameSources := make(map[string][]string)
+	for _, path := range extra {
+		rEntry := remoteEntries[path]
+		if !rEntry.GetIsDir() && rEntry.GetCheckSum() != "" && !isDeleted(path) {
+			key := fmt.Sprintf("%s:%d", rEntry.GetCheckSum(), rEntry.GetSize())
+			renameSources[key] = append(renameSources[key], path)
+		}
+	}
+
+	renamedFrom := make(map[string]string)
+	renamedTo := make(map[string]bool)
+	for _, lEntry := range local {
+		if _, ok := remoteEntries[lEntry.GetPath()]; ok || lEntry.GetIsDir() || lEntry.GetCheckSum() == "" {
+			continue
+		}
+
+		key := fmt.Sprintf("%s:%d", lEntry.GetCheckSum(), lEntry.GetSize())
+		if len(renameSources[key]) == 0 {
+			continue
+		}
+
+		oldPath := renameSources[key][0]
+		renameSources[key] = renameSources[key][1:]
+		renamedFrom[lEntry.GetPath()] = oldPath
+		renamedTo[oldPath] = true
+
+		report.Items = append(report.Items, Drift{
+			Kind:    DriftRenamed,
+			Path:    lEntry.GetPath(),
+			OldPath: oldPath,
+		})
+	}
+
+	for _, path := range extra {
+		if !renamedTo[path] {
+			addExtra(path)
+		}
+	}
+
+	for _, lEntry := range local {
+		item := Drift{
+			Path:  lEntry.GetPath(),
+			IsDir: lEntry.GetIsDir(),
+			Mode:  lEntry.GetMode(),
+		}
+
+		rEntry, ok := remoteEntries[lEntry.GetPath()]
+		if oldPath, renamed := renamedFrom[lEntry.GetPath()]; renamed {
+			rEntry, ok = remoteEntries[oldPath], true
+		}
+
+		if lEntry.GetIsDir() && (!ok || !rEntry.GetIsDir()) {
+			// Already reported above.
+			continue
+		}
+
+		if !ok || rEntry.GetIsDir() != lEntry.GetIsDir() {
+			item.Kind = DriftMissing
+			report.Items = append(report.Items, item)
+			continue
+		}
+
+		if !lEntry.GetIsDir() {
+			checkSumDiffers := lEntry.GetCheckSum() != "" && rEntry.GetCheckSum() != "" &&
+				lEntry.GetCheckSum() != rEntry.GetCheckSum()
+
+			if lEntry.GetSize() != rEntry.GetSize() || checkSumDiffers {
+				item.Kind = DriftChanged
+				report.Items = append(report.Items, item)
+			}
+		}
+
+		// Reported even when the content changed too, so the report shows
+		// everything that differs.
+		if lEntry.GetMode() != rEntry.GetMode() {
+			item.Kind = DriftMode
+			report.Items = append(report.Items, item)
+		}
+	}
+
+	return report
+}
+
+// Reconciler periodically compares the local tree against the remote and
+// queues whatever is needed to make them match again. This heals drift from
+// events the watcher missed.
+type Reconciler struct {
+	tm        *TransferManager
+	interval  time.Duration
+	checksums bool
+	done      chan struct{}
+}
+
+// NewReconciler Create new instance of Reconciler. Content is compared by
+// checksum if checksums is set, otherwise only by size.
+func NewReconciler(transferManager *TransferManager, interval time.Duration, checksums bool) *Reconciler {
+	return &Reconciler{
+		tm:        transferManager,
+		interval:  interval,
+		checksums: checksums,
+		done:      make(chan struct{}),
+	}
+}
+
+// Run Compare the trees once and queue corrective operations.
+func (rc *Reconciler) Run() (*DriftReport, error) {
+	local, err := ListTree(rc.tm.basePath, rc.checksums)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list local tree: %s", err.Error())
+	}
+
+	remote, err := rc.tm.sender.ListTree(rc.checksums)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list remote tree: %s", err.Error())
+	}
+
+	// Excluded paths are left alone on both ends.
+	exclude := rc.tm.Exclude()
+	report := CompareTree(exclude.FilterTree(local), exclude.FilterTree(remote))
+
+	written := make(map[string]bool)
+	for _, item := range report.Items {
+		if item.Kind == DriftChanged {
+			written[item.Path] = true
+		}
+	}
+
+	for _, item := range report.Items {
+		switch {
+		case item.Kind == DriftExtra:
+			rc.tm.Add(QueueItem{
+				Action: TmActionDelete,
+				Path:   item.Path,
+				IsDir:  item.IsDir,
+			})
+
+		case item.Kind == DriftRenamed:
+			rc.tm.Add(QueueItem{
+				Action:     TmActionRename,
+				Path:       item.OldPath,
+				RenamePath: item.Path,
+			})
+
+		case item.Kind == DriftMode && written[item.Path]:
+			// Writing the file sets its mode as well.
+
+		case item.Kind == DriftMode:
+			rc.tm.Add(QueueItem{
+				Action: TmActionChmod,
+				Path:   item.Path,
+				Mode:   item.Mode,
+				IsDir:  item.IsDir,
+			})
+
+		case item.IsDir:
+			rc.tm.Add(QueueItem{
+				Action: TmActionMkdir,
+				Path:   item.Path,
+				Mode:   item.Mode,
+				IsDir:  true,
+			})
+
+		default:
+			rc.tm.Add(QueueItem{
+				Action: TmActionWrite,
+				Path:   item.Path,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// Start Run reconciliation at the configured interval.
+func (rc *Reconciler) Start() {
+	go func() {
+		ticker := time.NewTicker(rc.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-rc.done:
+				return
+			}
+
+			// Operations still in the queue would show up as drift.
+			if rc.tm.Len() > 0 {
+				continue
+			}
+
+			report, err := rc.Run()
+			if err != nil {
+				rc.tm.Logger.Error("Reconciliation failed", Fields{"error": err})
+				continue
+			}
+
+			if len(report.Items) == 0 {
+				continue
+			}
+
+			rc.tm.Logger.Warn("Reconciliation found drift", Fields{
+				"missing": report.Count(DriftMissing),
+				"changed": report.Count(DriftChanged),
+				"mode":    report.Count(DriftMode),
+				"renamed": report.Count(DriftRenamed),
+				"extra":   report.Count(DriftExtra),
+			})
+
+			for _, item := range report.Items {
+				fields := Fields{"drift": item.Kind, "path": item.Path}
+				if item.Kind == DriftRenamed {
+					fields["path"] = item.OldPath
+					fields["to"] = item.Path
+				}
+
+				rc.tm.Logger.Info("Drift", fields)
+			}
+		}
+	}()
+}
+
+// Stop Stop reconciling.
+func (rc *Reconciler) Stop() {
+	close(rc.done)
+}
@@ -0,0 +1,157 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareTree(t *testing.T) {
+	file := func(path string, size int64, checkSum string) *TreeEntry {
+		return &TreeEntry{Path: path, Size: size, Mode: 0644, CheckSum: checkSum}
+	}
+
+	dir := func(path string) *TreeEntry {
+		return &TreeEntry{Path: path, IsDir: true, Mode: 0755}
+	}
+
+	tests := []struct {
+		name   string
+		local  []*TreeEntry
+		remote []*TreeEntry
+		want   []Drift
+	}{
+		{
+			name:   "equal trees",
+			local:  []*TreeEntry{dir("d"), file("d/f", 1, "a")},
+			remote: []*TreeEntry{dir("d"), file("d/f", 1, "a")},
+		},
+		{
+			name:  "missing directory comes before its content",
+			local: []*TreeEntry{file("d/f", 1, ""), dir("d")},
+			want: []Drift{
+				{Kind: DriftMissing, Path: "d", IsDir: true, Mode: 0755},
+				{Kind: DriftMissing, Path: "d/f", Mode: 0644},
+			},
+		},
+		{
+			name:   "size differs",
+			local:  []*TreeEntry{file("f", 2, "")},
+			remote: []*TreeEntry{file("f", 1, "")},
+			want:   []Drift{{Kind: DriftChanged, Path: "f", Mode: 0644}},
+		},
+		{
+			name:   "checksum differs",
+			local:  []*TreeEntry{file("f", 1, "a")},
+			remote: []*TreeEntry{file("f", 1, "b")},
+			want:   []Drift{{Kind: DriftChanged, Path: "f", Mode: 0644}},
+		},
+		{
+			name:   "checksum only on one side",
+			local:  []*TreeEntry{file("f", 1, "a")},
+			remote: []*TreeEntry{file("f", 1, "")},
+		},
+		{
+			name:   "mode differs",
+			local:  []*TreeEntry{{Path: "f", Size: 1, Mode: 0600}},
+			remote: []*TreeEntry{file("f", 1, "")},
+			want:   []Drift{{Kind: DriftMode, Path: "f", Mode: 0600}},
+		},
+		{
+			name:   "size and mode differ",
+			local:  []*TreeEntry{{Path: "f", Size: 2, Mode: 0600}},
+			remote: []*TreeEntry{file("f", 1, "")},
+			want: []Drift{
+				{Kind: DriftChanged, Path: "f", Mode: 0600},
+				{Kind: DriftMode, Path: "f", Mode: 0600},
+			},
+		},
+		{
+			name:   "only the topmost extra path is deleted",
+			remote: []*TreeEntry{dir("d"), file("d/f", 1, ""), dir("d/e"), file("x", 1, "")},
+			want: []Drift{
+				{Kind: DriftExtra, Path: "d", IsDir: true},
+				{Kind: DriftExtra, Path: "x"},
+			},
+		},
+		{
+			name:   "renamed file",
+			local:  []*TreeEntry{file("new", 1, "a")},
+			remote: []*TreeEntry{file("old", 1, "a"), file("other", 1, "b")},
+			want: []Drift{
+				{Kind: DriftRenamed, Path: "new", OldPath: "old"},
+				{Kind: DriftExtra, Path: "other"},
+			},
+		},
+		{
+			name:   "file replaced by directory",
+			local:  []*TreeEntry{dir("p")},
+			remote: []*TreeEntry{file("p", 1, "")},
+			want: []Drift{
+				{Kind: DriftExtra, Path: "p"},
+				{Kind: DriftMissing, Path: "p", IsDir: true, Mode: 0755},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := CompareTree(tt.local, tt.remote)
+			if !reflect.DeepEqual(report.Items, tt.want) {
+				t.Errorf("CompareTree() = %+v, want %+v", report.Items, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcilerRun(t *testing.T) {
+	dir := testTree(t)
+	writeTestFile(t, filepath.Join(dir, "d", "f"), "ff")
+	writeTestFile(t, filepath.Join(dir, "m"), "m")
+	writeTestFile(t, filepath.Join(dir, "same"), "s")
+	writeTestFile(t, filepath.Join(dir, "w"), "ww")
+
+	for _, path := range []string{"m", "w"} {
+		if err := os.Chmod(filepath.Join(dir, path), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sender := connectTestReceiver(t, &testReceiver{
+		tree: []*TreeEntry{
+			{Path: "d", IsDir: true, Mode: 0755},
+			{Path: "d/f", Size: 1, Mode: 0644},
+			{Path: "m", Size: 1, Mode: 0644},
+			{Path: "same", Size: 1, Mode: 0644},
+			{Path: "w", Size: 1, Mode: 0644},
+			{Path: "x", IsDir: true, Mode: 0755},
+			{Path: "x/y", Size: 1, Mode: 0644},
+		},
+	})
+
+	tm := NewTransferManager(sender, dir, nil, newJobMetrics("test"))
+	report, err := NewReconciler(tm, 0, false).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	if got, want := report.String(), "0 missing, 2 changed, 2 mode, 0 renamed, 1 extra"; got != want {
+		t.Errorf("report is %q, want %q", got, want)
+	}
+
+	want := []QueueItem{
+		{Action: TmActionDelete, Path: "x", IsDir: true},
+		{Action: TmActionWrite, Path: "d/f", Size: 2},
+		{Action: TmActionChmod, Path: "m", Mode: 0600},
+		{Action: TmActionWrite, Path: "w", Size: 2},
+	}
+
+	if !reflect.DeepEqual(tm.queue, want) {
+		t.Errorf("Run queued %+v, want %+v", tm.queue, want)
+	}
+}
@@ -7,183 +7,878 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
 )
 
 // Sender implementation of fileserver.
 type Sender struct {
-	listener    *net.Listener
-	client      ReceiverServiceClient
+	listener *net.Listener
+	client   ReceiverServiceClient
+
+	// The connection and whether we may send on it, changed by the
+	// connection watcher while the queue is being processed.
+	conn        *grpc.ClientConn
 	isConnected bool
+	connMtx     sync.Mutex
+
+	// Cancelled to abort the RPCs in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// BlockSize Size of the blocks files are compared and sent in, 0 picks
+	// one based on the size of the file.
+	BlockSize int64
+
+	// BasePath Local directory the paths we send are relative to.
+	BasePath string
+
+	// Limiter Limits the rate file data is sent at, nil if unlimited.
+	Limiter *BandwidthLimiter
+
+	// Timeouts How long each kind of RPC may take before it is given up.
+	Timeouts RPCTimeouts
+
+	// Verify Check the file on the remote after sending it.
+	Verify bool
+
+	// OnVerifyFailure Called when a file on the remote doesn't match after
+	// sending it.
+	OnVerifyFailure func()
+
+	// OnReconnect Called when the connection to the remote is back after
+	// being lost.
+	OnReconnect func()
+
+	progress    *FileProgress
+	progressMtx sync.Mutex
+
+	// What was agreed on in the handshake, nil until it is done.
+	caps    *Capabilities
+	capsMtx sync.Mutex
+}
+
+// RPCTimeouts How long RPCs may take, by kind. 0 means no deadline.
+type RPCTimeouts struct {
+	// Operations on metadata, like creating, renaming and deleting.
+	Default time.Duration
+
+	// Writing a block of data or punching a hole.
+	Block time.Duration
+
+	// RPCs that make the receiver read a whole file, like getting its
+	// checksum or completing a transfer.
+	Checksum time.Duration
+
+	// Listing the whole tree.
+	ListTree time.Duration
+}
+
+// DefaultRPCTimeouts The deadlines a sender starts out with.
+func DefaultRPCTimeouts() RPCTimeouts {
+	return RPCTimeouts{
+		Default:  30 * time.Second,
+		Block:    time.Minute,
+		Checksum: 10 * time.Minute,
+		ListTree: time.Hour,
+	}
+}
+
+// For Get the deadline of a method, given by its full name.
+func (t RPCTimeouts) For(method string) time.Duration {
+	switch path.Base(method) {
+	case "WriteFileBlock", "PunchHole":
+		return t.Block
+	case "GetFileChecksum", "GetFileMeta", "BeginTransfer", "CommitTransfer":
+		return t.Checksum
+	case "ListTree":
+		return t.ListTree
+	}
+
+	return t.Default
+}
+
+// IncompatibleError The receiver speaks a protocol we can't work with.
+type IncompatibleError struct {
+	Reason string
+}
+
+// Error Describe why the receiver is incompatible.
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("Incompatible receiver: %s", e.Reason)
+}
+
+// FileProgress How far Sync has come with sending a file.
+type FileProgress struct {
+	Path        string
+	BlocksDone  int64
+	BlocksTotal int64
+
+	// Bytes of the blocks that have to be sent.
+	BytesDone  int64
+	BytesTotal int64
+	Started    time.Time
+}
+
+// Progress Get the progress of the file being sent, nil if there is none.
+func (s *Sender) Progress() *FileProgress {
+	s.progressMtx.Lock()
+	defer s.progressMtx.Unlock()
+
+	if s.progress == nil {
+		return nil
+	}
+
+	progress := *s.progress
+	return &progress
+}
+
+// setProgress Update the progress of the file being sent.
+func (s *Sender) setProgress(progress *FileProgress) {
+	s.progressMtx.Lock()
+	s.progress = progress
+	s.progressMtx.Unlock()
 }
 
 // NewSender Create new instance of Sender.
 func NewSender() *Sender {
-	return &Sender{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Sender{
+		ctx:      ctx,
+		cancel:   cancel,
+		Timeouts: DefaultRPCTimeouts(),
+	}
+}
+
+// withDeadline Give unary RPCs the deadline of their kind.
+func (s *Sender) withDeadline(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if timeout := s.Timeouts.For(method); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// Context Get the context RPCs are made in, it is cancelled by Cancel.
+// Contexts of single operations should be derived from it.
+func (s *Sender) Context() context.Context {
+	return s.ctx
 }
 
 // Connect to remote.
 func (s *Sender) Connect(address string) error {
-	s.isConnected = false
-	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	s.setConnected(false)
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithUnaryInterceptor(s.withDeadline))
 
 	if err != nil {
 		return fmt.Errorf("Failed to connect to %s: %s", address, err.Error())
 	}
 
+	s.connMtx.Lock()
+	s.conn = conn
+	s.connMtx.Unlock()
 	s.client = NewReceiverServiceClient(conn)
-	s.isConnected = true
+
+	err = s.handshake(address)
+	if _, ok := err.(*IncompatibleError); ok {
+		conn.Close()
+		return err
+	} else if err != nil {
+		// Likely not up yet, we try again when the connection is ready.
+		logger.Warn("Handshake failed, retrying when connected", Fields{"remote": address, "error": err})
+	}
+
+	s.setConnected(true)
+
+	go s.watchConnection(conn, address)
 
 	return nil
 }
 
-// Sync Send a file to the remote.
-func (s *Sender) Sync(filePath string) error {
+// handshake Tell the receiver what we support and agree on what to use.
+// Receivers from before the handshake are assumed to support only what they
+// did back then.
+func (s *Sender) handshake(address string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	var caps *Capabilities
+
+	resp, err := s.client.Hello(ctx, newHelloRequest())
+	switch status.Code(err) {
+	case codes.OK:
+		caps, err = negotiate(resp)
+		if err != nil {
+			return &IncompatibleError{Reason: err.Error()}
+		}
+
+	case codes.Unimplemented:
+		logger.Warn("Receiver is too old for the handshake, some features are disabled", Fields{"remote": address})
+		caps = legacyCapabilities()
+
+	case codes.FailedPrecondition:
+		return &IncompatibleError{Reason: status.Convert(err).Message()}
+
+	default:
+		return err
+	}
+
+	var features []string
+	for feature := range caps.Features {
+		features = append(features, feature)
+	}
+
+	sort.Strings(features)
+
+	logger.Info("Handshake done", Fields{
+		"remote":      address,
+		"version":     caps.Version,
+		"protocol":    caps.ProtocolVersion,
+		"hash":        caps.HashAlgorithm,
+		"compression": caps.Compression,
+		"features":    strings.Join(features, ","),
+	})
+
+	s.capsMtx.Lock()
+	s.caps = caps
+	s.capsMtx.Unlock()
+
+	return nil
+}
+
+// Capabilities Get what was agreed on with the receiver. Until the handshake
+// is done we assume it is an old receiver.
+func (s *Sender) Capabilities() *Capabilities {
+	s.capsMtx.Lock()
+	defer s.capsMtx.Unlock()
+
+	if s.caps == nil {
+		return legacyCapabilities()
+	}
+
+	return s.caps
+}
+
+// watchConnection Log when the connection to the remote is lost and comes
+// back, until it is closed. gRPC reconnects by itself.
+func (s *Sender) watchConnection(conn *grpc.ClientConn, address string) {
+	lost := false
+
+	for {
+		state := conn.GetState()
+
+		switch {
+		case state == connectivity.Shutdown:
+			return
+
+		case state == connectivity.TransientFailure && !lost:
+			lost = true
+			logger.Warn("Lost connection to receiver", Fields{"remote": address})
+
+		case state == connectivity.Ready && lost:
+			lost = false
+			logger.Info("Reconnected to receiver", Fields{"remote": address})
+
+			if s.OnReconnect != nil {
+				s.OnReconnect()
+			}
+
+			// The receiver may have been replaced by another version.
+			s.redoHandshake(address)
+
+		case state == connectivity.Ready && s.handshakePending():
+			s.redoHandshake(address)
+		}
+
+		if !conn.WaitForStateChange(context.Background(), state) {
+			return
+		}
+	}
+}
+
+// State Get the state of the connection to the remote, like READY or
+// TRANSIENT_FAILURE.
+func (s *Sender) State() string {
+	conn, _ := s.connection()
+	if conn == nil {
+		return "NOT_CONNECTED"
+	}
+
+	return conn.GetState().String()
+}
+
+// connection Get the connection to the remote and whether we may send on it.
+func (s *Sender) connection() (*grpc.ClientConn, bool) {
+	s.connMtx.Lock()
+	defer s.connMtx.Unlock()
+
+	return s.conn, s.isConnected
+}
+
+// setConnected Set whether we may send to the remote.
+func (s *Sender) setConnected(connected bool) {
+	s.connMtx.Lock()
+	s.isConnected = connected
+	s.connMtx.Unlock()
+}
+
+// Connected Check if we can send to the remote now. False while the
+// connection is lost and being re-established, or if the remote was refused
+// in the handshake.
+func (s *Sender) Connected() bool {
+	conn, connected := s.connection()
+	if !connected || conn == nil {
+		return false
+	}
+
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Connecting, connectivity.Shutdown:
+		return false
+	}
+
+	return true
+}
+
+// handshakePending Check if the handshake has not been done yet.
+func (s *Sender) handshakePending() bool {
+	s.capsMtx.Lock()
+	defer s.capsMtx.Unlock()
+
+	return s.caps == nil
+}
+
+// redoHandshake Do the handshake again, and stop sending if the receiver is
+// not compatible.
+func (s *Sender) redoHandshake(address string) {
+	s.capsMtx.Lock()
+	s.caps = nil
+	s.capsMtx.Unlock()
+
+	err := s.handshake(address)
+	if _, ok := err.(*IncompatibleError); ok {
+		logger.Error("Not sending to receiver", Fields{"remote": address, "error": err})
+		s.setConnected(false)
+		return
+	} else if err != nil {
+		logger.Warn("Handshake failed, retrying when connected", Fields{"remote": address, "error": err})
+		return
+	}
+
+	s.setConnected(true)
+}
+
+// Cancel Abort the RPCs in flight, and fail any made after.
+func (s *Sender) Cancel() {
+	s.cancel()
+}
+
+// Close the connection to the remote.
+func (s *Sender) Close() error {
+	conn, _ := s.connection()
+	if conn == nil {
+		return nil
+	}
+
+	s.setConnected(false)
+	return conn.Close()
+}
+
+// localPath Path of a file on the sender end.
+func (s *Sender) localPath(path string) string {
+	return filepath.Join(s.BasePath, path)
+}
+
+// VerifyError The file on the remote didn't match after sending it.
+// RemoteChecksum is empty if the remote found the mismatch itself.
+type VerifyError struct {
+	Path           string
+	Checksum       string
+	RemoteChecksum string
+}
+
+// Error Describe the mismatch.
+func (e *VerifyError) Error() string {
+	if e.RemoteChecksum == "" {
+		return fmt.Sprintf("Verification of '%s' failed, the remote doesn't have checksum %s", e.Path, e.Checksum)
+	}
+
+	return fmt.Sprintf("Verification of '%s' failed, checksum is %s on the remote and %s here", e.Path, e.RemoteChecksum, e.Checksum)
+}
+
+// GRPCStatus Get the error as a status, a mismatch is DataLoss.
+func (e *VerifyError) GRPCStatus() *status.Status {
+	return status.New(codes.DataLoss, e.Error())
+}
+
+// sentFile Checksums of a file that was sent. RemoteChecksum is empty if
+// the remote didn't report it when the transfer was completed.
+type sentFile struct {
+	Checksum       string
+	RemoteChecksum string
+}
+
+// SyncResult How much of a file Sync had to send.
+type SyncResult struct {
+	BytesSent int64
+
+	// Bytes the remote already had, or that were holes.
+	BytesSkipped int64
+
+	// Mismatch Why the file didn't match on the remote the first time it
+	// was sent, if it had to be sent again.
+	Mismatch error
+}
+
+// Sync Send a file to the remote. With Verify set the file on the remote is
+// checked against ours afterwards. If it doesn't match, or the remote finds
+// that it doesn't when completing the transfer, the whole file is sent again.
+func (s *Sender) Sync(ctx context.Context, filePath string) (SyncResult, error) {
+	result, sent, err := s.sendFile(ctx, filePath, false)
+	if err == nil && sent != nil && s.Verify {
+		err = s.verify(ctx, filePath, sent)
+	}
+
+	if _, ok := err.(*VerifyError); !ok {
+		return result, err
+	}
+
+	logger.Warn("Verification failed, sending the whole file again", Fields{"path": filePath, "error": err})
+	if s.OnVerifyFailure != nil {
+		s.OnVerifyFailure()
+	}
+
+	result.Mismatch = err
+
+	retry, sent, err := s.sendFile(ctx, filePath, true)
+	result.BytesSent += retry.BytesSent
+
+	if err == nil && sent != nil && s.Verify {
+		err = s.verify(ctx, filePath, sent)
+	}
+
+	if _, ok := err.(*VerifyError); ok && s.OnVerifyFailure != nil {
+		s.OnVerifyFailure()
+	}
+
+	return result, err
+}
+
+// verify Check that the file on the remote matches what was sent. A file
+// that changed here while it was sent is not reported, it is queued again
+// by the watcher.
+func (s *Sender) verify(ctx context.Context, filePath string, sent *sentFile) error {
+	remoteSum := sent.RemoteChecksum
+
+	if remoteSum == "" {
+		resp, err := s.client.GetFileChecksum(ctx, &FileRequest{Path: filePath})
+		if err != nil {
+			return syncError(err, "Failed to get checksum of '%s' on the remote", filePath)
+		}
+
+		remoteSum = resp.GetChecksum()
+	}
+
+	if remoteSum == sent.Checksum {
+		return nil
+	}
+
+	localSum, err := GetChecksum(s.localPath(filePath))
+	if err != nil || localSum != sent.Checksum {
+		logger.Debug("File changed while it was sent", Fields{"path": filePath})
+		return nil
+	}
+
+	return &VerifyError{
+		Path:           filePath,
+		Checksum:       sent.Checksum,
+		RemoteChecksum: remoteSum,
+	}
+}
+
+// sendFile Send the blocks of a file the remote doesn't have, or all of them
+// if full is set. sent is nil if the remote already had the file.
+func (s *Sender) sendFile(ctx context.Context, filePath string, full bool) (result SyncResult, sent *sentFile, err error) {
 	// First compare checksums and exit early if the files are the same.
-	localSum, err := GetChecksum(filePath)
+	localSum, err := GetChecksum(s.localPath(filePath))
 
 	if err != nil {
-		return fmt.Errorf("Failed to get checksum for '%s': %s", filePath, err.Error())
+		return result, nil, syncError(err, "Failed to get checksum for '%s'", filePath)
 	}
 
-	remoteSum, err := s.client.GetFileChecksum(context.Background(), &FileRequest{
+	remoteSum, err := s.client.GetFileChecksum(ctx, &FileRequest{
 		Path: filePath,
 	})
 
 	if err == nil && localSum == remoteSum.GetChecksum() {
-		return nil
+		if fInfo, err := os.Stat(s.localPath(filePath)); err == nil {
+			result.BytesSkipped = fInfo.Size()
+		}
+
+		return result, nil, nil
 	}
 
 	// Get metadata for the file on the sender end.
-	localFile, err := ReadFile(filePath, 0)
+	localFile, err := ReadFile(s.localPath(filePath), s.BlockSize)
 
 	if err != nil {
-		return fmt.Errorf("Failed to read '%s': %s", filePath, err.Error())
+		return result, nil, syncError(err, "Failed to read '%s'", filePath)
 	}
 
-	// Touch file if it doesn't exist.
-	s.Touch(filePath)
-
 	defer localFile.Close()
 
+	caps := s.Capabilities()
+	resumable := caps.Has(FeatureResumable) && localFile.Size > 0
+
+	// Touch file if it doesn't exist.
+	if !resumable {
+		err = s.Touch(ctx, filePath)
+		if err != nil {
+			return result, nil, err
+		}
+	}
+
 	// File has no content yet, so we only create it.
 	if localFile.Size == 0 {
-		s.Chmod(filePath, localFile.Mode)
-		return nil
+		err = s.Chmod(ctx, filePath, localFile.Mode)
+		if err != nil {
+			return result, nil, err
+		}
+
+		return result, &sentFile{Checksum: localSum}, nil
 	}
 
-	// Get metadata for the file on the receiver end.
-	remoteFile, err := GetRemoteFileMeta(s.client, filePath, localFile.BlockSize)
+	missingBlocks := GetMissingBlocks(localFile, nil)
+	if !full {
+		missingBlocks = s.missingBlocks(ctx, filePath, localFile)
+	}
 
-	// Find the delta between the origin file and the remote.
-	var missingBlocks []int64
-	if err != nil {
-		missingBlocks = GetMissingBlocks(localFile, nil)
-	} else {
-		// Compare the file on the remote and return the missing blocks.
-		missingBlocks = GetMissingBlocks(localFile, remoteFile)
+	// Blocks are written to a partial file on the remote that replaces the
+	// file when complete. Those received by an earlier attempt to send this
+	// version of the file are not sent again, unless all are to be sent.
+	if resumable {
+		transfer, err := s.client.BeginTransfer(ctx, &BeginTransferRequest{
+			Path:      filePath,
+			Checksum:  localSum,
+			Size:      localFile.Size,
+			BlockSize: localFile.BlockSize,
+		})
+
+		if err != nil {
+			return result, nil, syncError(err, "Failed to begin transfer of '%s'", filePath)
+		}
+
+		if transfer.GetResumed() && !full {
+			received := make(map[int64]bool)
+			for _, index := range transfer.GetReceivedBlocks() {
+				received[index] = true
+			}
+
+			var remaining []int64
+			for _, index := range missingBlocks {
+				if !received[index] {
+					remaining = append(remaining, index)
+				}
+			}
+
+			logger.Info("Resuming transfer", Fields{
+				"path":   filePath,
+				"blocks": len(missingBlocks) - len(remaining),
+			})
+
+			missingBlocks = remaining
+		}
+	}
+
+	progress := FileProgress{
+		Path:        filePath,
+		BlocksTotal: int64(len(missingBlocks)),
+		Started:     time.Now(),
 	}
 
+	for _, blockNum := range missingBlocks {
+		if blockMeta, err := localFile.GetBlockMeta(blockNum); err == nil {
+			progress.BytesTotal += blockMeta.Size
+		}
+	}
+
+	s.setProgress(&progress)
+	defer s.setProgress(nil)
+
+	sparse := caps.Has(FeatureSparse)
+
 	// Write blocks returned above to the remote.
 	for _, blockNum := range missingBlocks {
 		blockMeta, err := localFile.GetBlockMeta(blockNum)
 		if err != nil {
-			return fmt.Errorf("Failed to get meta for block #%d in file '%s': %s", blockNum, filePath, err.Error())
+			return result, nil, syncError(err, "Failed to get meta for block #%d in file '%s'", blockNum, filePath)
+		}
+
+		progress.BlocksDone++
+		progress.BytesDone += blockMeta.Size
+
+		// Holes are punched on the remote instead of sending zeroes.
+		if blockMeta.Hole && sparse {
+			_, err = s.client.PunchHole(ctx, &PunchHoleRequest{
+				Path:    filePath,
+				Offset:  blockMeta.Offset,
+				Size:    blockMeta.Size,
+				Index:   blockNum,
+				Partial: resumable,
+			})
+
+			if err != nil {
+				return result, nil, syncError(err, "Failed to punch hole in '%s' @ offset %d", filePath, blockMeta.Offset)
+			}
+
+			s.setProgress(&progress)
+			continue
 		}
 
 		blockData, err := localFile.GetBlockData(blockNum)
 		if err != nil {
-			return fmt.Errorf("Failed to get block data for block #%d in file '%s': %s", blockNum, filePath, err.Error())
+			return result, nil, syncError(err, "Failed to get block data for block #%d in file '%s'", blockNum, filePath)
+		}
+
+		err = s.Limiter.Wait(ctx, blockMeta.Size)
+		if err != nil {
+			return result, nil, syncError(err, "Failed to write to '%s'", filePath)
 		}
 
-		_, err = s.client.WriteFileBlock(context.Background(), &WriteFileBlockRequest{
+		_, err = s.client.WriteFileBlock(ctx, &WriteFileBlockRequest{
 			FilePath: filePath,
 			Offset:   blockMeta.Offset,
 			Size:     blockMeta.Size,
 			Data:     blockData,
+			Index:    blockNum,
+			Partial:  resumable,
 		})
 
 		if err != nil {
-			return fmt.Errorf("Failed to write to '%s': %s", filePath, err.Error())
+			return result, nil, syncError(err, "Failed to write to '%s'", filePath)
 		}
+
+		result.BytesSent += blockMeta.Size
+		s.setProgress(&progress)
+	}
+
+	// A file that grew while it was read has more data than its size.
+	result.BytesSkipped = localFile.Size - result.BytesSent
+	if result.BytesSkipped < 0 {
+		result.BytesSkipped = 0
+	}
+
+	if resumable {
+		commit, err := s.client.CommitTransfer(ctx, &CommitTransferRequest{
+			Path:     filePath,
+			Checksum: localSum,
+			Size:     localFile.Size,
+			Mode:     localFile.Mode,
+		})
+
+		// The receiver checks the checksum itself before replacing the file.
+		if status.Code(err) == codes.DataLoss {
+			return result, nil, &VerifyError{Path: filePath, Checksum: localSum}
+		}
+
+		if err != nil {
+			return result, nil, syncError(err, "Failed to complete transfer of '%s'", filePath)
+		}
+
+		return result, &sentFile{Checksum: localSum, RemoteChecksum: commit.GetChecksum()}, nil
 	}
 
 	// Truncate file to the correct size.
-	_, err = s.client.TruncateFile(context.Background(), &TruncateFileRequest{
+	_, err = s.client.TruncateFile(ctx, &TruncateFileRequest{
 		Path: filePath,
 		Size: localFile.Size,
 	})
 
 	if err != nil {
-		return fmt.Errorf("Failed to truncate file '%s' at %d bytes: %s", filePath, localFile.Size, err.Error())
+		return result, nil, syncError(err, "Failed to truncate file '%s' at %d bytes", filePath, localFile.Size)
 	}
 
 	// Set correct permissions.
-	s.Chmod(filePath, localFile.Mode)
+	err = s.Chmod(ctx, filePath, localFile.Mode)
+	if err != nil {
+		return result, nil, err
+	}
 
-	return nil
+	return result, &sentFile{Checksum: localSum}, nil
+}
+
+// missingBlocks Find the blocks of a local file that differ on the remote.
+func (s *Sender) missingBlocks(ctx context.Context, filePath string, localFile *FileMeta) []int64 {
+	// Get metadata for the file on the receiver end.
+	remoteFile, err := GetRemoteFileMeta(ctx, s.client, filePath, localFile.BlockSize)
+
+	// Find the delta between the origin file and the remote.
+	if err != nil {
+		return GetMissingBlocks(localFile, nil)
+	}
+
+	// Compare the file on the remote and return the missing blocks.
+	return GetMissingBlocks(localFile, remoteFile)
+}
+
+// SyncPlan What Sync would do for a file.
+type SyncPlan struct {
+	Path string
+
+	// File doesn't exist on the remote.
+	Create bool
+
+	NumBlocks     int64
+	MissingBlocks int64
+
+	// Bytes of block data that would be sent, holes are not counted.
+	Bytes int64
+}
+
+// PlanSync Find what Sync would send for a file, using only the read-only RPCs.
+func (s *Sender) PlanSync(filePath string) (*SyncPlan, error) {
+	plan := &SyncPlan{Path: filePath}
+
+	localSum, err := GetChecksum(s.localPath(filePath))
+	if err != nil {
+		return nil, syncError(err, "Failed to get checksum for '%s'", filePath)
+	}
+
+	remoteSum, err := s.client.GetFileChecksum(s.ctx, &FileRequest{
+		Path: filePath,
+	})
+
+	if err == nil && localSum == remoteSum.GetChecksum() {
+		return plan, nil
+	}
+
+	plan.Create = err != nil
+
+	localFile, err := ReadFile(s.localPath(filePath), s.BlockSize)
+	if err != nil {
+		return nil, syncError(err, "Failed to read '%s'", filePath)
+	}
+
+	defer localFile.Close()
+
+	plan.NumBlocks = localFile.NumBlocks
+	if localFile.Size == 0 {
+		return plan, nil
+	}
+
+	for _, blockNum := range s.missingBlocks(s.ctx, filePath, localFile) {
+		blockMeta, err := localFile.GetBlockMeta(blockNum)
+		if err != nil {
+			return nil, syncError(err, "Failed to get meta for block #%d in file '%s'", blockNum, filePath)
+		}
+
+		plan.MissingBlocks++
+		if !blockMeta.Hole {
+			plan.Bytes += blockMeta.Size
+		}
+	}
+
+	return plan, nil
 }
 
 // Touch file if it doesn't exist.
-func (s *Sender) Touch(path string) error {
-	_, err := s.client.Touch(context.Background(), &FileRequest{
+func (s *Sender) Touch(ctx context.Context, path string) error {
+	_, err := s.client.Touch(ctx, &FileRequest{
 		Path: path,
 	})
 
-	return err
+	return syncError(err, "Failed to create '%s'", path)
 }
 
 // Chmod Chmod a file or directory.
-func (s *Sender) Chmod(path string, mode uint32) error {
-	_, err := s.client.Chmod(context.Background(), &FileRequest{
+func (s *Sender) Chmod(ctx context.Context, path string, mode uint32) error {
+	_, err := s.client.Chmod(ctx, &FileRequest{
 		Path: path,
 		Mode: mode,
 	})
 
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return syncError(err, "Failed to set mode of '%s'", path)
 }
 
 // CreateDirectory Create a directory on the remote.
-func (s *Sender) CreateDirectory(path string, mode uint32) error {
+func (s *Sender) CreateDirectory(ctx context.Context, path string, mode uint32) error {
 	if path == "." || path == ".." {
 		return nil
 	}
 
-	_, err := s.client.CreateDirectory(context.Background(), &FileRequest{
+	_, err := s.client.CreateDirectory(ctx, &FileRequest{
 		Path: path,
 		Mode: mode,
 	})
 
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return syncError(err, "Failed to create directory '%s'", path)
 }
 
 // Delete file or directory.
-func (s *Sender) Delete(path string) error {
-	_, err := s.client.Delete(context.Background(), &FileRequest{Path: path})
+func (s *Sender) Delete(ctx context.Context, path string) error {
+	_, err := s.client.Delete(ctx, &FileRequest{Path: path})
+
+	return syncError(err, "Failed to delete '%s'", path)
+}
+
+// ListTree Get all files and directories on the remote.
+func (s *Sender) ListTree(withChecksums bool) ([]*TreeEntry, error) {
+	if !s.Capabilities().Has(FeatureListTree) {
+		return nil, fmt.Errorf("The receiver can't list its tree, it has to be upgraded")
+	}
+
+	// Streams are not given a deadline by withDeadline, so it is set here.
+	ctx := s.ctx
+	if s.Timeouts.ListTree > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeouts.ListTree)
+		defer cancel()
+	}
+
+	stream, err := s.client.ListTree(ctx, &ListTreeRequest{
+		WithChecksums: withChecksums,
+	})
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	var entries []*TreeEntry
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
 }
 
 // Rename file or directory.
-func (s *Sender) Rename(oldPath string, newPath string) error {
-	_, err := s.client.Rename(context.Background(), &RenameRequest{
+func (s *Sender) Rename(ctx context.Context, oldPath string, newPath string) error {
+	_, err := s.client.Rename(ctx, &RenameRequest{
 		OldPath: oldPath,
 		NewPath: newPath,
 	})
 
-	return err
+	return syncError(err, "Failed to rename '%s' to '%s'", oldPath, newPath)
 }
@@ -0,0 +1,193 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// corruptingReceiver A receiver that flips a byte in the first corrupt
+// blocks it is sent.
+type corruptingReceiver struct {
+	*Receiver
+	mtx     sync.Mutex
+	corrupt int
+}
+
+// WriteFileBlock Write the block, corrupted if there are any left to corrupt.
+func (r *corruptingReceiver) WriteFileBlock(ctx context.Context, req *WriteFileBlockRequest) (*EmptyResponse, error) {
+	r.mtx.Lock()
+	if r.corrupt > 0 {
+		r.corrupt--
+		data := append([]byte(nil), req.GetData()...)
+		data[0] ^= 0xff
+		req = &WriteFileBlockRequest{
+			FilePath: req.GetFilePath(),
+			Offset:   req.GetOffset(),
+			Size:     req.GetSize(),
+			Data:     data,
+			Index:    req.GetIndex(),
+			Partial:  req.GetPartial(),
+		}
+	}
+	r.mtx.Unlock()
+
+	return r.Receiver.WriteFileBlock(ctx, req)
+}
+
+func TestSyncResendsOnVerifyFailure(t *testing.T) {
+	remote := enterTestTree(t)
+	local := testTree(t)
+	content := "0123456789abcdef"
+	writeTestFile(t, filepath.Join(local, "f"), content)
+
+	for _, test := range []struct {
+		name     string
+		corrupt  int
+		failures int
+		ok       bool
+	}{
+		{"clean", 0, 0, true},
+		{"corrupted once", 1, 1, true},
+		{"corrupted every time", 100, 2, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			writeTestFile(t, filepath.Join(remote, "f"), "")
+
+			sender := connectTestReceiver(t, &corruptingReceiver{Receiver: NewReceiver(), corrupt: test.corrupt})
+			defer sender.Close()
+
+			failures := 0
+			sender.BasePath = local
+			sender.BlockSize = 4
+			sender.Verify = true
+			sender.OnVerifyFailure = func() { failures++ }
+
+			_, err := sender.Sync(context.Background(), "f")
+			if _, isVerifyError := err.(*VerifyError); test.ok && err != nil || !test.ok && !isVerifyError {
+				t.Fatalf("Sync returned %v", err)
+			}
+
+			if failures != test.failures {
+				t.Errorf("%d verify failures reported, want %d", failures, test.failures)
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(remote, "f"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.ok && string(data) != content {
+				t.Errorf("Remote file is %q, want %q", data, content)
+			}
+		})
+	}
+}
+
+func TestTransferManagerReportsMismatch(t *testing.T) {
+	enterTestTree(t)
+	local := testTree(t)
+	writeTestFile(t, filepath.Join(local, "f"), "0123456789abcdef")
+
+	sender := connectTestReceiver(t, &corruptingReceiver{Receiver: NewReceiver(), corrupt: 1})
+	defer sender.Close()
+	sender.BasePath = local
+	sender.BlockSize = 4
+
+	tm := NewTransferManager(sender, local, nil, newJobMetrics("test"))
+	if err := tm.Add(QueueItem{Action: TmActionWrite, Path: filepath.Join(local, "f")}); err != nil {
+		t.Fatal(err)
+	}
+
+	tm.Drain()
+
+	status := tm.Status(0)
+	if len(status.Summary.Failed) != 0 {
+		t.Errorf("Failed is %+v, want nothing since the file was sent again", status.Summary.Failed)
+	}
+
+	if len(status.Recent) != 1 || status.Recent[0].Item.Path != "f" {
+		t.Fatalf("Recent errors are %+v, want the mismatch of f", status.Recent)
+	}
+
+	if _, ok := status.Recent[0].Err.(*VerifyError); !ok {
+		t.Errorf("Recent error is %v, want a VerifyError", status.Recent[0].Err)
+	}
+}
+
+// serveTestReceiver Serve a receiver on address, 127.0.0.1:0 for a free port.
+func serveTestReceiver(t *testing.T, address string) (*grpc.Server, string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	RegisterReceiverServiceServer(server, &testReceiver{})
+	go server.Serve(listener)
+
+	return server, listener.Addr().String()
+}
+
+// waitConnected Wait until the sender is connected or not.
+func waitConnected(t *testing.T, sender *Sender, connected bool) {
+	deadline := time.Now().Add(10 * time.Second)
+
+	for sender.Connected() != connected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Connected didn't become %t, state is %s", connected, sender.State())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSenderReconnectWhilePolled(t *testing.T) {
+	server, address := serveTestReceiver(t, "127.0.0.1:0")
+
+	sender := NewSender()
+	if err := sender.Connect(address); err != nil {
+		t.Fatal(err)
+	}
+
+	defer sender.Close()
+
+	done := make(chan struct{})
+	polled := make(chan struct{})
+
+	go func() {
+		defer close(polled)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				sender.Connected()
+				sender.State()
+			}
+		}
+	}()
+
+	// The receiver is restarted, the sender reconnects by itself and does
+	// the handshake again while the queue keeps checking if it can send.
+	server.Stop()
+	waitConnected(t, sender, false)
+
+	server, _ = serveTestReceiver(t, address)
+	defer server.Stop()
+	waitConnected(t, sender, true)
+
+	close(done)
+	<-polled
+}
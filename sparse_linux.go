@@ -0,0 +1,89 @@
+//go:build linux
+// +build linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	seekData = 3
+	seekHole = 4
+
+	fallocKeepSize  = 0x01
+	fallocPunchHole = 0x02
+)
+
+// FindHoles Returns the holes in a sparse file using SEEK_DATA/SEEK_HOLE.
+// Filesystems without support for this report the whole file as data.
+func FindHoles(fh *os.File, size int64) ([]Extent, error) {
+	var holes []Extent
+	var offset int64
+
+	for offset < size {
+		data, err := fh.Seek(offset, seekData)
+		if err != nil {
+			// ENXIO means there is no more data after offset.
+			if pErr, ok := err.(*os.PathError); ok && pErr.Err == syscall.ENXIO {
+				holes = append(holes, Extent{Offset: offset, Size: size - offset})
+				break
+			}
+
+			return nil, err
+		}
+
+		if data > offset {
+			holes = append(holes, Extent{Offset: offset, Size: data - offset})
+		}
+
+		offset, err = fh.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := fh.Seek(0, os.SEEK_SET)
+	return holes, err
+}
+
+// PunchHole Deallocate the given range of a file without changing its size.
+func PunchHole(fh *os.File, offset int64, size int64) error {
+	return syscall.Fallocate(int(fh.Fd()), fallocPunchHole|fallocKeepSize, offset, size)
+}
+
+// CloneFile Make the empty file dst share the data of src, on filesystems
+// with copy-on-write clones like btrfs and XFS.
+func CloneFile(dst *os.File, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// CopyRange Copy size bytes at offset in src to the same offset in dst,
+// inside the kernel if the filesystem supports it.
+func CopyRange(dst *os.File, src *os.File, offset int64, size int64) error {
+	for size > 0 {
+		rOffset, wOffset := offset, offset
+		n, err := unix.CopyFileRange(int(src.Fd()), &rOffset, int(dst.Fd()), &wOffset, int(size), 0)
+		if err != nil {
+			// Not supported between these files, copy it ourselves.
+			return copyRange(dst, src, offset, size)
+		}
+
+		// src is shorter than expected.
+		if n == 0 {
+			return nil
+		}
+
+		offset += int64(n)
+		size -= int64(n)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// FindHoles Hole detection is only supported on Linux, so every file is
+// treated as fully allocated.
+func FindHoles(fh *os.File, size int64) ([]Extent, error) {
+	return nil, nil
+}
+
+// PunchHole Hole punching is only supported on Linux.
+func PunchHole(fh *os.File, offset int64, size int64) error {
+	return fmt.Errorf("hole punching is not supported on this platform")
+}
+
+// CloneFile Cloning files is only supported on Linux.
+func CloneFile(dst *os.File, src *os.File) error {
+	return fmt.Errorf("cloning files is not supported on this platform")
+}
+
+// CopyRange Copy size bytes at offset in src to the same offset in dst.
+func CopyRange(dst *os.File, src *os.File, offset int64, size int64) error {
+	return copyRange(dst, src, offset, size)
+}
@@ -5,10 +5,14 @@ Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -31,61 +35,546 @@ const (
 	TmActionRename = iota
 )
 
+// actionNames Names of the actions as shown in logs and summaries.
+var actionNames = map[uint]string{
+	TmActionTouch:  "TOUCH",
+	TmActionChmod:  "CHMOD",
+	TmActionWrite:  "WRITE",
+	TmActionDelete: "REMOVE",
+	TmActionMkdir:  "MKDIR",
+	TmActionRename: "RENAME",
+}
+
 // QueueItem Represents a file or directory to be transferred.
 type QueueItem struct {
 	Path       string
 	RenamePath string
 	Mode       uint32
 	Action     uint
+
+	// Path is a directory. Set for deletes too, where it can't be looked up
+	// since the path is gone.
+	IsDir bool
+
+	// Size of the file when it was queued, for progress reporting.
+	Size int64
+
+	// Attempts that failed with a transient error so far.
+	Attempts int
+}
+
+// ActionName Name of the action to perform on the item.
+func (item *QueueItem) ActionName() string {
+	return actionNames[item.Action]
+}
+
+// FailedItem A queue item that could not be transferred, and when.
+type FailedItem struct {
+	Item QueueItem
+	Err  error
+	Time time.Time
+}
+
+// maxRecentErrors Number of failed items kept for the status command.
+const maxRecentErrors = 20
+
+// maxSupersedes Number of times in a row a transfer of a file is cancelled
+// for a newer change to it. After that the transfer is finished, so a file
+// that is written all the time is still sent now and then.
+const maxSupersedes = 3
+
+// RetryPolicy How items that fail with a transient error are retried. The
+// wait doubles after every attempt, from InitialBackoff up to MaxBackoff.
+type RetryPolicy struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy The retry policy a transfer manager starts out with.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+	}
+}
+
+// backoff How long to wait before the given attempt, counting from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	return wait
+}
+
+// TransferSummary Outcome of the items processed so far.
+type TransferSummary struct {
+	// Number of successful operations by action name.
+	Processed map[string]int
+	Failed    []FailedItem
 }
 
 // TransferManager Handles queue of files to transfer.
 type TransferManager struct {
-	sender *Sender
-	queue  []QueueItem
-	mtx    sync.Mutex
+	sender    *Sender
+	basePath  string
+	exclude   *ExcludeFilter
+	queue     []QueueItem
+	processed map[string]int
+	failed    []FailedItem
+	recent    []FailedItem
+	mtx       sync.Mutex
+	done      chan struct{}
+
+	// Held while an item is being transferred.
+	busy sync.Mutex
+
+	// Progress of the current batch, the items queued since the queue was
+	// last empty.
+	batchDone      int
+	batchBytesDone int64
+	queuedBytes    int64
+	inFlight       *QueueItem
+
+	// Cancels the item being transferred, and whether it was cancelled
+	// because a newer change to it was queued.
+	cancelInFlight context.CancelFunc
+	superseded     bool
+
+	// Number of times in a row the transfer of a path was superseded.
+	supersedes map[string]int
+
+	// Totals since the transfer manager was created.
+	bytesSent    int64
+	bytesSkipped int64
+
+	metrics *jobMetrics
+
+	// RetryPolicy How items that fail with a transient error are retried.
+	RetryPolicy RetryPolicy
+
+	// Logger Where transfers are logged.
+	Logger *Logger
 }
 
-// NewTransferManager Create new instance of TransferManager.
-func NewTransferManager(sender *Sender) *TransferManager {
+// NewTransferManager Create new instance of TransferManager. Items are queued
+// with paths below basePath, and sent with paths relative to it.
+func NewTransferManager(sender *Sender, basePath string, exclude *ExcludeFilter, metrics *jobMetrics) *TransferManager {
 	return &TransferManager{
-		sender: sender,
+		sender:     sender,
+		basePath:   basePath,
+		exclude:    exclude,
+		processed:  make(map[string]int),
+		supersedes: make(map[string]int),
+		done:       make(chan struct{}),
+		metrics:    metrics,
+		Logger:     logger,
+
+		RetryPolicy: DefaultRetryPolicy(),
 	}
 }
 
-// Start Transfer queue processor.
+// Start Transfer queue processor, runs until Stop is called.
 func (tq *TransferManager) Start() {
 	for {
-		tq.processQueue()
+		tq.processQueue(false)
+
 		// TODO: Use signaling instead of sleep.
-		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-tq.done:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
 	}
 }
 
+// Stop Stop processing the queue and wait for the item being transferred to
+// finish. Items still in the queue are dropped.
+func (tq *TransferManager) Stop() {
+	tq.mtx.Lock()
+	if !tq.isStopping() {
+		close(tq.done)
+	}
+	tq.mtx.Unlock()
+
+	tq.busy.Lock()
+	tq.busy.Unlock()
+}
+
+// isStopping Check if Stop has been called.
+func (tq *TransferManager) isStopping() bool {
+	select {
+	case <-tq.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain Process the queue until it is empty and return. Unlike Start it
+// doesn't wait for the receiver forever: if it can't be reached within the
+// retries of RetryPolicy, everything still queued is recorded as failed.
+func (tq *TransferManager) Drain() {
+	tq.processQueue(true)
+}
+
+// Summary Get the outcome of the items processed so far.
+func (tq *TransferManager) Summary() TransferSummary {
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	summary := TransferSummary{
+		Processed: make(map[string]int),
+		Failed:    append([]FailedItem(nil), tq.failed...),
+	}
+
+	for action, n := range tq.processed {
+		summary.Processed[action] = n
+	}
+
+	return summary
+}
+
 // Add transfer task.
 func (tq *TransferManager) Add(item QueueItem) error {
-	filePath, err := StripBasepath(item.Path)
+	filePath, err := StripBasepath(tq.basePath, item.Path)
 
 	if err != nil {
 		return fmt.Errorf("StripBasePath error: %s", err.Error())
 	}
 
 	item.Path = filePath
+	exclude := tq.Exclude()
+
+	if item.Action == TmActionRename {
+		renamePath, err := StripBasepath(tq.basePath, item.RenamePath)
+		if err != nil {
+			return fmt.Errorf("StripBasePath error: %s", err.Error())
+		}
+
+		item.RenamePath = renamePath
+
+		// Moving into or out of an excluded path is a delete or a create
+		// as far as the remote is concerned.
+		switch {
+		case exclude.Match(item.Path, item.IsDir) && exclude.Match(item.RenamePath, item.IsDir):
+			return nil
+
+		case exclude.Match(item.RenamePath, item.IsDir):
+			item.Action = TmActionDelete
+			item.RenamePath = ""
+
+		case exclude.Match(item.Path, item.IsDir):
+			tq.AddTree(filepath.Join(tq.basePath, item.RenamePath))
+			return nil
+		}
+	} else if exclude.Match(item.Path, item.IsDir || item.Action == TmActionMkdir) {
+		return nil
+	}
+
+	if item.Action == TmActionWrite {
+		if fInfo, err := os.Stat(filepath.Join(tq.basePath, item.Path)); err == nil {
+			item.Size = fInfo.Size()
+		}
+	}
 
 	tq.mtx.Lock()
-	tq.queue = append(tq.queue, item)
+	tq.enqueue(item)
+	tq.supersede(item)
 	tq.mtx.Unlock()
 
 	return nil
 }
 
-// Pop first item off the queue.
-func (tq *TransferManager) pop() *QueueItem {
-	if len(tq.queue) == 0 {
+// supersede Cancel the write in flight if item makes what it sends stale,
+// by writing to or deleting the same file. Has to be called with mtx held.
+func (tq *TransferManager) supersede(item QueueItem) {
+	if tq.inFlight == nil || tq.superseded || tq.cancelInFlight == nil {
+		return
+	}
+
+	if tq.inFlight.Action != TmActionWrite || tq.inFlight.Path != item.Path {
+		return
+	}
+
+	if item.Action != TmActionWrite && item.Action != TmActionDelete {
+		return
+	}
+
+	if tq.supersedes[item.Path] >= maxSupersedes {
+		return
+	}
+
+	tq.supersedes[item.Path]++
+	tq.superseded = true
+	tq.cancelInFlight()
+}
+
+// enqueue Add an item to the end of the queue. Has to be called with mtx
+// held.
+func (tq *TransferManager) enqueue(item QueueItem) {
+	tq.queue = append(tq.queue, item)
+	tq.queuedBytes += item.Size
+	tq.metrics.queueLength.Set(float64(len(tq.queue)))
+}
+
+// requeue Put an item back at the front of the queue, so it is retried
+// before the items queued after it. Has to be called with mtx held.
+func (tq *TransferManager) requeue(item QueueItem) {
+	tq.queue = append([]QueueItem{item}, tq.queue...)
+	tq.queuedBytes += item.Size
+	tq.metrics.queueLength.Set(float64(len(tq.queue)))
+}
+
+// fail Record an item that failed for good, replacing an earlier failure
+// of the same operation. Has to be called with mtx held.
+func (tq *TransferManager) fail(item QueueItem, err error) {
+	failed := FailedItem{Item: item, Err: err, Time: time.Now()}
+
+	tq.clearFailed(item)
+	tq.failed = append(tq.failed, failed)
+
+	tq.addRecentError(failed)
+}
+
+// addRecentError Keep a failed item for the status command, dropping the
+// oldest past maxRecentErrors. Has to be called with mtx held.
+func (tq *TransferManager) addRecentError(failed FailedItem) {
+	tq.recent = append(tq.recent, failed)
+	if len(tq.recent) > maxRecentErrors {
+		tq.recent = tq.recent[1:]
+	}
+}
+
+// clearFailed Forget earlier failures of the operation of item, it has
+// succeeded or failed again since. A delete makes any earlier failure on the
+// path moot. Has to be called with mtx held.
+func (tq *TransferManager) clearFailed(item QueueItem) {
+	var failed []FailedItem
+
+	for _, f := range tq.failed {
+		same := f.Item.Action == item.Action && f.Item.RenamePath == item.RenamePath
+		if f.Item.Path != item.Path || (!same && item.Action != TmActionDelete) {
+			failed = append(failed, f)
+		}
+	}
+
+	tq.failed = failed
+}
+
+// Failed Get the items that failed for good.
+func (tq *TransferManager) Failed() []FailedItem {
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	return append([]FailedItem(nil), tq.failed...)
+}
+
+// Retry Queue failed items again, those with one of paths or all of them if
+// paths is empty. Returns the items that were queued.
+func (tq *TransferManager) Retry(paths []string) []FailedItem {
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, path := range paths {
+		wanted[path] = true
+	}
+
+	var retried, failed []FailedItem
+
+	for _, f := range tq.failed {
+		if len(paths) > 0 && !wanted[f.Item.Path] {
+			failed = append(failed, f)
+			continue
+		}
+
+		item := f.Item
+		item.Attempts = 0
+
+		tq.enqueue(item)
+		retried = append(retried, f)
+	}
+
+	tq.failed = failed
+
+	return retried
+}
+
+// AddTree Queue a file, or a directory and everything below it.
+func (tq *TransferManager) AddTree(path string) {
+	walkFunc := func(wPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if tq.Excluded(wPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if info.IsDir() {
+			tq.Add(QueueItem{
+				Action: TmActionMkdir,
+				Path:   wPath,
+				Mode:   uint32(info.Mode().Perm()),
+				IsDir:  true,
+			})
+		} else {
+			tq.Add(QueueItem{
+				Action: TmActionWrite,
+				Path:   wPath,
+			})
+		}
+
 		return nil
 	}
 
+	filepath.Walk(path, walkFunc)
+}
+
+// Excluded Check if a path is excluded from the sync. isDir tells if the
+// path is a directory.
+func (tq *TransferManager) Excluded(path string, isDir bool) bool {
+	relPath, err := StripBasepath(tq.basePath, path)
+	if err != nil {
+		return false
+	}
+
+	return tq.Exclude().Match(relPath, isDir)
+}
+
+// Exclude Get the filter of paths not to sync.
+func (tq *TransferManager) Exclude() *ExcludeFilter {
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	return tq.exclude
+}
+
+// SetExclude Change the filter of paths not to sync. Paths that are no
+// longer excluded are not queued, the caller has to rescan for them.
+func (tq *TransferManager) SetExclude(exclude *ExcludeFilter) {
 	tq.mtx.Lock()
+	tq.exclude = exclude
+	tq.mtx.Unlock()
+}
+
+// QueueProgress How far the transfer manager has come with the items
+// queued since the queue was last empty. Bytes are counted from the size of
+// the files, whether they had to be sent or not.
+type QueueProgress struct {
+	ItemsDone  int
+	ItemsTotal int
+	BytesDone  int64
+	BytesTotal int64
+
+	// File being sent, if any.
+	Current *FileProgress
+}
+
+// Progress Get the progress of the current batch.
+func (tq *TransferManager) Progress() QueueProgress {
+	current := tq.sender.Progress()
+
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	progress := QueueProgress{
+		ItemsDone:  tq.batchDone,
+		ItemsTotal: tq.batchDone + len(tq.queue),
+		BytesDone:  tq.batchBytesDone,
+		BytesTotal: tq.batchBytesDone + tq.queuedBytes,
+	}
+
+	if tq.inFlight != nil {
+		progress.ItemsTotal++
+		progress.BytesTotal += tq.inFlight.Size
+
+		if current != nil && current.Path == tq.inFlight.Path && current.BlocksTotal > 0 {
+			progress.BytesDone += tq.inFlight.Size * current.BlocksDone / current.BlocksTotal
+			progress.Current = current
+		}
+	}
+
+	return progress
+}
+
+// TransferStatus What the transfer manager is doing and has done.
+type TransferStatus struct {
+	QueueLength int
+	Queued      []QueueItem
+	InFlight    *QueueItem
+	Progress    QueueProgress
+	Summary     TransferSummary
+	Recent      []FailedItem
+
+	BytesSent    int64
+	BytesSkipped int64
+}
+
+// Status Get the state of the transfer manager, with at most maxItems of the
+// items waiting in the queue.
+func (tq *TransferManager) Status(maxItems int) TransferStatus {
+	progress := tq.Progress()
+	summary := tq.Summary()
+
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	queued := tq.queue
+	if len(queued) > maxItems {
+		queued = queued[:maxItems]
+	}
+
+	status := TransferStatus{
+		QueueLength:  len(tq.queue),
+		Queued:       append([]QueueItem(nil), queued...),
+		Progress:     progress,
+		Summary:      summary,
+		Recent:       append([]FailedItem(nil), tq.recent...),
+		BytesSent:    tq.bytesSent,
+		BytesSkipped: tq.bytesSkipped,
+	}
+
+	if tq.inFlight != nil {
+		inFlight := *tq.inFlight
+		status.InFlight = &inFlight
+	}
+
+	return status
+}
+
+// Len Number of items waiting in the queue.
+func (tq *TransferManager) Len() int {
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	return len(tq.queue)
+}
+
+// Pop first item off the queue, with the context to transfer it in. The
+// context is cancelled if the item is superseded.
+func (tq *TransferManager) pop() (*QueueItem, context.Context) {
+	tq.mtx.Lock()
+
+	if len(tq.queue) == 0 {
+		// The batch is done.
+		tq.batchDone = 0
+		tq.batchBytesDone = 0
+		tq.mtx.Unlock()
+		return nil, nil
+	}
 
 	it := tq.queue[0]
 
@@ -95,52 +584,232 @@ func (tq *TransferManager) pop() *QueueItem {
 		tq.queue = nil
 	}
 
+	ctx, cancel := context.WithCancel(tq.sender.Context())
+
+	tq.queuedBytes -= it.Size
+	tq.inFlight = &it
+	tq.cancelInFlight = cancel
+	tq.superseded = false
+	tq.metrics.queueLength.Set(float64(len(tq.queue)))
 	tq.mtx.Unlock()
-	return &it
+	return &it, ctx
 }
 
-// Process pendining transfers.
-func (tq *TransferManager) processQueue() {
-	if !tq.sender.isConnected {
-		time.Sleep(1 * time.Second)
-		tq.processQueue()
+// waitConnected Wait until the sender is connected. Returns false if Stop
+// is called first. When draining we wait with backoff, and give up after the
+// retries of RetryPolicy by failing everything in the queue.
+func (tq *TransferManager) waitConnected(drain bool) bool {
+	for attempt := 1; !tq.sender.Connected(); attempt++ {
+		wait := 1 * time.Second
+
+		if drain {
+			if attempt > tq.RetryPolicy.MaxRetries {
+				tq.failQueue(&SyncError{
+					Code:    codes.Unavailable,
+					Message: "Gave up waiting for the receiver",
+					Err:     fmt.Errorf("Not connected after %d retries", tq.RetryPolicy.MaxRetries),
+				})
+				return false
+			}
+
+			wait = tq.RetryPolicy.backoff(attempt)
+		}
+
+		select {
+		case <-tq.done:
+			return false
+		case <-time.After(wait):
+		}
+	}
+
+	return true
+}
+
+// failQueue Record everything in the queue as failed with err and empty it.
+func (tq *TransferManager) failQueue(err error) {
+	tq.mtx.Lock()
+	defer tq.mtx.Unlock()
+
+	if len(tq.queue) == 0 {
 		return
 	}
 
+	tq.Logger.Error("Receiver unreachable, giving up", Fields{"items": len(tq.queue), "error": err})
+
+	for _, item := range tq.queue {
+		tq.fail(item, err)
+		tq.metrics.operations.WithLabelValues(item.ActionName(), "failure").Inc()
+	}
+
+	tq.queue = nil
+	tq.queuedBytes = 0
+	tq.batchDone = 0
+	tq.batchBytesDone = 0
+	tq.metrics.queueLength.Set(0)
+}
+
+// Process pendining transfers. Items that fail with a transient error are
+// retried with backoff, ahead of the rest of the queue, and recorded as
+// failed once they run out of retries. Other failures are recorded right
+// away, unless the item was cancelled because a newer change to it is
+// queued. When draining, attempts made while disconnected count too, so the
+// queue is given up on if the receiver doesn't come back.
+func (tq *TransferManager) processQueue(drain bool) {
 	for {
-		item := tq.pop()
+		if !tq.waitConnected(drain) {
+			return
+		}
+
+		tq.busy.Lock()
+		if tq.isStopping() {
+			tq.busy.Unlock()
+			return
+		}
+
+		item, ctx := tq.pop()
 		if item == nil {
+			tq.busy.Unlock()
 			return
 		}
 
-		switch item.Action {
-		case TmActionTouch:
-			log.Printf("TOUCH\t%s\n", item.Path)
-			tq.sender.Touch(item.Path)
+		start := time.Now()
+		result, err := tq.processItem(ctx, item)
+		duration := time.Since(start)
 
-		case TmActionChmod:
-			log.Printf("CHMOD\t%s\t%d\n", item.Path, item.Mode)
-			tq.sender.Chmod(item.Path, item.Mode)
+		tq.mtx.Lock()
+		superseded := tq.superseded && err != nil
+		tq.cancelInFlight()
+		tq.cancelInFlight = nil
+		tq.superseded = false
 
-		case TmActionWrite:
-			log.Printf("WRITE\t%s\n", item.Path)
-			tq.sender.Sync(item.Path)
+		if !superseded {
+			delete(tq.supersedes, item.Path)
+		}
+		tq.mtx.Unlock()
 
-		case TmActionMkdir:
-			log.Printf("MKDIR\t%s\t%d\n", item.Path, item.Mode)
-			tq.sender.CreateDirectory(item.Path, item.Mode)
+		// Losing the connection doesn't count as an attempt unless we are
+		// draining, otherwise we wait for it to come back.
+		retry := err != nil && !superseded && IsTransient(err) && !tq.isStopping()
+		backoff := time.Duration(0)
 
-		case TmActionDelete:
-			log.Printf("REMOVE\t%s\n", item.Path)
-			tq.sender.Delete(item.Path)
+		if retry && (drain || tq.sender.Connected()) {
+			item.Attempts++
+			retry = item.Attempts <= tq.RetryPolicy.MaxRetries
+			backoff = tq.RetryPolicy.backoff(item.Attempts)
+		}
 
+		tq.mtx.Lock()
+		switch {
+		case retry:
+			tq.requeue(*item)
+		case superseded:
+		case err != nil:
+			tq.fail(*item, err)
+		default:
+			tq.processed[item.ActionName()]++
+			tq.clearFailed(*item)
+		}
+
+		// A file that had to be sent again to match is shown in the status
+		// even though it made it in the end.
+		if result.Mismatch != nil {
+			tq.addRecentError(FailedItem{Item: *item, Err: result.Mismatch, Time: time.Now()})
+		}
+
+		tq.bytesSent += result.BytesSent
+		tq.bytesSkipped += result.BytesSkipped
+
+		if !retry {
+			tq.batchDone++
+			tq.batchBytesDone += item.Size
+		}
+
+		tq.inFlight = nil
+		tq.mtx.Unlock()
+
+		outcome := "success"
+		if retry {
+			outcome = "retry"
+		} else if superseded {
+			outcome = "superseded"
+		} else if err != nil {
+			outcome = "failure"
+		}
+
+		tq.metrics.operations.WithLabelValues(item.ActionName(), outcome).Inc()
+		tq.metrics.bytesSent.Add(float64(result.BytesSent))
+		tq.metrics.bytesSkipped.Add(float64(result.BytesSkipped))
+
+		fields := Fields{
+			"action":   item.ActionName(),
+			"path":     item.Path,
+			"duration": duration,
+		}
+
+		switch item.Action {
+		case TmActionWrite:
+			tq.metrics.syncDuration.Observe(duration.Seconds())
+			fields["bytes"] = result.BytesSent
 		case TmActionRename:
-			newPath, err := StripBasepath(item.RenamePath)
+			fields["to"] = item.RenamePath
+		case TmActionChmod, TmActionMkdir:
+			fields["mode"] = fmt.Sprintf("%04o", item.Mode&0777)
+		}
 
-			if err == nil {
-				log.Printf("RENAME\t%s\t%d\n", item.Path, item.Mode)
-				tq.sender.Rename(item.Path, newPath)
+		if err != nil && !superseded {
+			fields["error"] = err
+			fields["code"] = errorCode(err)
+		}
+
+		switch {
+		case superseded:
+			tq.Logger.Info("Transfer superseded by a newer change", fields)
+		case retry && backoff == 0:
+			tq.Logger.Warn("Sync failed, retrying when reconnected", fields)
+		case retry:
+			fields["attempt"] = item.Attempts
+			fields["retry_in"] = backoff
+			tq.Logger.Warn("Sync failed, retrying", fields)
+		case err != nil:
+			tq.Logger.Error("Sync failed", fields)
+		default:
+			tq.Logger.Info("Synced", fields)
+		}
+
+		tq.busy.Unlock()
+
+		if retry && backoff > 0 {
+			select {
+			case <-tq.done:
+				return
+			case <-time.After(backoff):
 			}
 		}
 	}
 }
+
+// processItem Perform the action of a single queue item on the remote, in
+// ctx. Only writes send file data, for the other actions the result is empty.
+func (tq *TransferManager) processItem(ctx context.Context, item *QueueItem) (SyncResult, error) {
+	switch item.Action {
+	case TmActionTouch:
+		return SyncResult{}, tq.sender.Touch(ctx, item.Path)
+
+	case TmActionChmod:
+		return SyncResult{}, tq.sender.Chmod(ctx, item.Path, item.Mode)
+
+	case TmActionWrite:
+		return tq.sender.Sync(ctx, item.Path)
+
+	case TmActionMkdir:
+		return SyncResult{}, tq.sender.CreateDirectory(ctx, item.Path, item.Mode)
+
+	case TmActionDelete:
+		return SyncResult{}, tq.sender.Delete(ctx, item.Path)
+
+	case TmActionRename:
+		return SyncResult{}, tq.sender.Rename(ctx, item.Path, item.RenamePath)
+	}
+
+	return SyncResult{}, fmt.Errorf("Unknown action %d", item.Action)
+}
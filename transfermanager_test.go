@@ -0,0 +1,302 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"first attempt", DefaultRetryPolicy(), 1, time.Second},
+		{"second attempt", DefaultRetryPolicy(), 2, 2 * time.Second},
+		{"fifth attempt", DefaultRetryPolicy(), 5, 16 * time.Second},
+		{"just below ceiling", DefaultRetryPolicy(), 6, 32 * time.Second},
+		{"at ceiling", DefaultRetryPolicy(), 7, time.Minute},
+		{"past ceiling", DefaultRetryPolicy(), 8, time.Minute},
+		{"far past ceiling", DefaultRetryPolicy(), 1000, time.Minute},
+		{"attempt zero", DefaultRetryPolicy(), 0, time.Second},
+
+		{"ceiling not a power of two", RetryPolicy{InitialBackoff: 3 * time.Second, MaxBackoff: 10 * time.Second}, 3, 10 * time.Second},
+		{"initial above ceiling", RetryPolicy{InitialBackoff: time.Minute, MaxBackoff: time.Second}, 1, time.Second},
+		{"ceiling equals initial", RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Second}, 4, time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.backoff(test.attempt); got != test.want {
+				t.Errorf("backoff(%d) = %s, want %s", test.attempt, got, test.want)
+			}
+		})
+	}
+}
+
+// failingReceiver A receiver whose Chmod fails with the given codes in turn,
+// and succeeds once they run out.
+type failingReceiver struct {
+	testReceiver
+	mtx   sync.Mutex
+	codes []codes.Code
+	calls int
+}
+
+// Chmod Fail with the next code, if any.
+func (r *failingReceiver) Chmod(ctx context.Context, req *FileRequest) (*EmptyResponse, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.calls++
+	if len(r.codes) == 0 {
+		return &EmptyResponse{}, nil
+	}
+
+	code := r.codes[0]
+	r.codes = r.codes[1:]
+
+	return nil, status.Errorf(code, "chmod failed")
+}
+
+func TestTransferManagerRetries(t *testing.T) {
+	transient := codes.ResourceExhausted
+
+	tests := []struct {
+		name      string
+		codes     []codes.Code
+		wantCalls int
+		wantFail  codes.Code
+	}{
+		{"success", nil, 1, codes.OK},
+		{"transient failures are retried", []codes.Code{transient, transient}, 3, codes.OK},
+		{"retries run out", []codes.Code{transient, transient, transient, transient}, 3, transient},
+		{"other failures are not retried", []codes.Code{codes.PermissionDenied}, 1, codes.PermissionDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := testTree(t)
+			receiver := &failingReceiver{codes: test.codes}
+			sender := connectTestReceiver(t, receiver)
+			defer sender.Close()
+
+			tm := NewTransferManager(sender, dir, nil, newJobMetrics("test"))
+			tm.RetryPolicy = RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+			if err := tm.Add(QueueItem{Action: TmActionChmod, Path: filepath.Join(dir, "f"), Mode: 0600}); err != nil {
+				t.Fatal(err)
+			}
+
+			tm.Drain()
+
+			if receiver.calls != test.wantCalls {
+				t.Errorf("Chmod was called %d times, want %d", receiver.calls, test.wantCalls)
+			}
+
+			failed := tm.Failed()
+			if test.wantFail == codes.OK {
+				if len(failed) != 0 {
+					t.Errorf("Failed is %+v, want nothing", failed)
+				}
+
+				return
+			}
+
+			if len(failed) != 1 || status.Code(failed[0].Err) != test.wantFail {
+				t.Fatalf("Failed is %+v, want chmod of f failing with %s", failed, test.wantFail)
+			}
+
+			if tm.Len() != 0 {
+				t.Errorf("%d items are still queued", tm.Len())
+			}
+		})
+	}
+}
+
+func TestTransferManagerRetryClearsFailed(t *testing.T) {
+	dir := testTree(t)
+	receiver := &failingReceiver{codes: []codes.Code{codes.PermissionDenied}}
+	sender := connectTestReceiver(t, receiver)
+	defer sender.Close()
+
+	tm := NewTransferManager(sender, dir, nil, newJobMetrics("test"))
+	if err := tm.Add(QueueItem{Action: TmActionChmod, Path: filepath.Join(dir, "f"), Mode: 0600}); err != nil {
+		t.Fatal(err)
+	}
+
+	tm.Drain()
+	if len(tm.Failed()) != 1 {
+		t.Fatalf("Failed is %+v, want the chmod of f", tm.Failed())
+	}
+
+	if retried := tm.Retry([]string{"other"}); len(retried) != 0 {
+		t.Errorf("Retry of another path queued %+v", retried)
+	}
+
+	if retried := tm.Retry(nil); len(retried) != 1 || retried[0].Item.Path != "f" {
+		t.Fatalf("Retry queued %+v, want the chmod of f", retried)
+	}
+
+	tm.Drain()
+
+	if failed := tm.Failed(); len(failed) != 0 {
+		t.Errorf("Failed is %+v after a successful retry, want nothing", failed)
+	}
+
+	if summary := tm.Summary(); summary.Processed["CHMOD"] != 1 {
+		t.Errorf("Processed is %+v, want one CHMOD", summary.Processed)
+	}
+}
+
+func TestTransferManagerSupersede(t *testing.T) {
+	write := QueueItem{Action: TmActionWrite, Path: "f"}
+
+	tests := []struct {
+		name     string
+		inFlight QueueItem
+		item     QueueItem
+		previous int
+		want     bool
+	}{
+		{"write of the same file", write, write, 0, true},
+		{"delete of the same file", write, QueueItem{Action: TmActionDelete, Path: "f"}, 0, true},
+		{"chmod of the same file", write, QueueItem{Action: TmActionChmod, Path: "f"}, 0, false},
+		{"write of another file", write, QueueItem{Action: TmActionWrite, Path: "g"}, 0, false},
+		{"in flight isn't a write", QueueItem{Action: TmActionMkdir, Path: "f"}, QueueItem{Action: TmActionDelete, Path: "f"}, 0, false},
+		{"superseded too often", write, write, maxSupersedes, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tm := NewTransferManager(nil, "", nil, newJobMetrics("test"))
+			inFlight := test.inFlight
+			cancelled := false
+
+			tm.inFlight = &inFlight
+			tm.cancelInFlight = func() { cancelled = true }
+			tm.supersedes[inFlight.Path] = test.previous
+
+			tm.supersede(test.item)
+			if cancelled != test.want || tm.superseded != test.want {
+				t.Errorf("supersede cancelled %t, want %t", cancelled, test.want)
+			}
+		})
+	}
+}
+
+// stallingReceiver A receiver that stalls the first checksum request until
+// it is cancelled.
+type stallingReceiver struct {
+	*Receiver
+	stalled chan struct{}
+	once    sync.Once
+}
+
+// GetFileChecksum Stall the first time, answer after that.
+func (r *stallingReceiver) GetFileChecksum(ctx context.Context, req *FileRequest) (*FileChecksumResponse, error) {
+	first := false
+	r.once.Do(func() { first = true })
+
+	if first {
+		close(r.stalled)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return r.Receiver.GetFileChecksum(ctx, req)
+}
+
+func TestTransferManagerSupersededWrite(t *testing.T) {
+	remote := enterTestTree(t)
+	local := testTree(t)
+	writeTestFile(t, filepath.Join(local, "f"), "new content")
+
+	receiver := &stallingReceiver{Receiver: NewReceiver(), stalled: make(chan struct{})}
+	sender := connectTestReceiver(t, receiver)
+	defer sender.Close()
+	sender.BasePath = local
+
+	tm := NewTransferManager(sender, local, nil, newJobMetrics("test"))
+	if err := tm.Add(QueueItem{Action: TmActionWrite, Path: filepath.Join(local, "f")}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		tm.Drain()
+		close(done)
+	}()
+
+	<-receiver.stalled
+	if err := tm.Add(QueueItem{Action: TmActionWrite, Path: filepath.Join(local, "f")}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The stalled transfer wasn't cancelled")
+	}
+
+	if failed := tm.Failed(); len(failed) != 0 {
+		t.Errorf("Failed is %+v, a superseded transfer isn't a failure", failed)
+	}
+
+	if summary := tm.Summary(); summary.Processed["WRITE"] != 1 {
+		t.Errorf("Processed is %+v, want the newer write only", summary.Processed)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(remote, "f"))
+	if err != nil || string(data) != "new content" {
+		t.Errorf("Remote file is %q (%v), want the new content", data, err)
+	}
+}
+
+func TestTransferManagerDrainGivesUp(t *testing.T) {
+	dir := testTree(t)
+
+	tm := NewTransferManager(NewSender(), dir, nil, newJobMetrics("test"))
+	tm.RetryPolicy = RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	for _, path := range []string{"a", "b"} {
+		if err := tm.Add(QueueItem{Action: TmActionChmod, Path: filepath.Join(dir, path), Mode: 0600}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		tm.Drain()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain kept waiting for a receiver that isn't there")
+	}
+
+	failed := tm.Failed()
+	if len(failed) != 2 || tm.Len() != 0 {
+		t.Fatalf("Failed is %+v with %d items queued, want both items failed", failed, tm.Len())
+	}
+
+	for _, f := range failed {
+		if status.Code(f.Err) != codes.Unavailable {
+			t.Errorf("%s failed with %v, want Unavailable", f.Item.Path, f.Err)
+		}
+	}
+}
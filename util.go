@@ -7,8 +7,8 @@ package main
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,7 +38,8 @@ func GetChecksum(filePath string) (string, error) {
 // ExitIfError If err is not nil exit with the corresponding error message.
 func ExitIfError(err error) {
 	if err != nil {
-		log.Fatalf("Error: %s\n", err.Error())
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 }
 
@@ -59,6 +60,29 @@ func ListDirectories(path string) []string {
 	return directoryList
 }
 
+// MoreDirectoriesThan Check if there are more than limit directories in a
+// directory and its subdirectories, itself included. Stops counting once
+// there are.
+func MoreDirectoriesThan(path string, limit int) bool {
+	count := 0
+
+	walkFunc := func(wPath string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			count++
+		}
+
+		if count > limit {
+			return io.EOF
+		}
+
+		return nil
+	}
+
+	filepath.Walk(path, walkFunc)
+
+	return count > limit
+}
+
 // ListFiles List all files in a directory and subdirectories.
 func ListFiles(path string) []string {
 	var fileList []string
@@ -76,6 +100,50 @@ func ListFiles(path string) []string {
 	return fileList
 }
 
+// ListTree List all files and directories below path with paths relative to
+// it. Symlinks are listed as what they point to, since that is what we sync.
+func ListTree(path string, withChecksums bool) ([]*TreeEntry, error) {
+	var entries []*TreeEntry
+
+	walkFunc := func(wPath string, info os.FileInfo, err error) error {
+		if err != nil || wPath == path {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(wPath)
+			if err != nil || info.IsDir() {
+				return nil
+			}
+		}
+
+		relPath, err := filepath.Rel(path, wPath)
+		if err != nil {
+			return err
+		}
+
+		entry := &TreeEntry{
+			Path:  relPath,
+			Size:  info.Size(),
+			Mode:  uint32(info.Mode().Perm()),
+			IsDir: info.IsDir(),
+		}
+
+		if info.IsDir() {
+			entry.Size = 0
+		} else if withChecksums {
+			entry.CheckSum, _ = GetChecksum(wPath)
+		}
+
+		entries = append(entries, entry)
+		return nil
+	}
+
+	err := filepath.Walk(path, walkFunc)
+
+	return entries, err
+}
+
 // IsDirectory Check if given path is a directory.
 func IsDirectory(path string) bool {
 	fInfo, err := os.Stat(path)
@@ -91,18 +159,23 @@ func IsDirectory(path string) bool {
 	return false
 }
 
-// StripBasepath from path.
-func StripBasepath(path string) (string, error) {
-	cwd, err := os.Getwd()
+// StripBasepath Make path relative to basePath. Relative paths are
+// assumed to already be relative to it.
+func StripBasepath(basePath string, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
 
+	relPath, err := filepath.Rel(basePath, path)
 	if err != nil {
 		return path, err
 	}
 
-	path = strings.TrimPrefix(path, cwd)
-	path = strings.TrimPrefix(path, "/")
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return path, fmt.Errorf("%s is outside of %s", path, basePath)
+	}
 
-	return path, nil
+	return relPath, nil
 }
 
 // GetFileMode Get mode/perm on a file or directory.
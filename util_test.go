@@ -0,0 +1,27 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoreDirectoriesThan(t *testing.T) {
+	dir := testTree(t)
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "a", "f"), "not a directory")
+
+	// The directory itself, a and a/b.
+	for limit, want := range map[int]bool{0: true, 2: true, 3: false, 100: false} {
+		if got := MoreDirectoriesThan(dir, limit); got != want {
+			t.Errorf("MoreDirectoriesThan(%d) = %t, want %t", limit, got, want)
+		}
+	}
+}
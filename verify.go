@@ -0,0 +1,182 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	// DiffMissing Path exists locally but not on the remote.
+	DiffMissing = "missing"
+
+	// DiffExtra Path exists on the remote but not locally.
+	DiffExtra = "extra"
+
+	// DiffType Path is a file on one end and a directory on the other.
+	DiffType = "type"
+
+	// DiffSize File size differs.
+	DiffSize = "size"
+
+	// DiffMode Permissions differ.
+	DiffMode = "mode"
+
+	// DiffChecksum File content differs, or couldn't be read on one end.
+	DiffChecksum = "checksum"
+)
+
+// Difference A way a path differs between the local tree and the remote,
+// with the value on each end.
+type Difference struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Local  string `json:"local,omitempty"`
+	Remote string `json:"remote,omitempty"`
+}
+
+// VerifyReport Result of comparing a local tree to the remote.
+type VerifyReport struct {
+	Job         string       `json:"job"`
+	Remote      string       `json:"remote"`
+	Checksums   bool         `json:"checksums"`
+	Files       int          `json:"files"`
+	Directories int          `json:"directories"`
+	Bytes       int64        `json:"bytes"`
+	Differences []Difference `json:"differences"`
+}
+
+// Write the differences as tab-separated lines of kind, path, local and
+// remote value.
+func (r *VerifyReport) Write(out io.Writer) {
+	for _, diff := range r.Differences {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", diff.Kind, diff.Path, diff.Local, diff.Remote)
+	}
+}
+
+// Verify Compare the local tree to the remote, by content too if checksums
+// is set. The remote reads every file to checksum it, so this also finds
+// files that rotted on its disk. Only the read-only RPCs are used.
+func Verify(sender *Sender, exclude *ExcludeFilter, checksums bool) (*VerifyReport, error) {
+	local, err := ListTree(sender.BasePath, checksums)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list local tree: %s", err.Error())
+	}
+
+	remote, err := sender.ListTree(checksums)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list remote tree: %s", err.Error())
+	}
+
+	local = exclude.FilterTree(local)
+	report := &VerifyReport{
+		Checksums:   checksums,
+		Differences: CompareEntries(local, exclude.FilterTree(remote), checksums),
+	}
+
+	for _, entry := range local {
+		if entry.GetIsDir() {
+			report.Directories++
+		} else {
+			report.Files++
+			report.Bytes += entry.GetSize()
+		}
+	}
+
+	return report, nil
+}
+
+// CompareEntries Find every difference between the local and the remote
+// tree, ordered by path. Unlike CompareTree nothing is left out or merged,
+// so every path that differs is listed.
+func CompareEntries(local []*TreeEntry, remote []*TreeEntry, checksums bool) []Difference {
+	localEntries := make(map[string]*TreeEntry)
+	remoteEntries := make(map[string]*TreeEntry)
+	var paths []string
+
+	for _, entry := range local {
+		localEntries[entry.GetPath()] = entry
+		paths = append(paths, entry.GetPath())
+	}
+
+	for _, entry := range remote {
+		remoteEntries[entry.GetPath()] = entry
+		if _, ok := localEntries[entry.GetPath()]; !ok {
+			paths = append(paths, entry.GetPath())
+		}
+	}
+
+	sort.Strings(paths)
+
+	// Empty rather than nil, so a JSON report has an empty list.
+	diffs := []Difference{}
+
+	for _, path := range paths {
+		lEntry, inLocal := localEntries[path]
+		rEntry, inRemote := remoteEntries[path]
+
+		switch {
+		case !inRemote:
+			diffs = append(diffs, Difference{Kind: DiffMissing, Path: path, Local: entryType(lEntry)})
+			continue
+
+		case !inLocal:
+			diffs = append(diffs, Difference{Kind: DiffExtra, Path: path, Remote: entryType(rEntry)})
+			continue
+
+		case lEntry.GetIsDir() != rEntry.GetIsDir():
+			diffs = append(diffs, Difference{Kind: DiffType, Path: path, Local: entryType(lEntry), Remote: entryType(rEntry)})
+			continue
+		}
+
+		if lEntry.GetSize() != rEntry.GetSize() {
+			diffs = append(diffs, Difference{
+				Kind:   DiffSize,
+				Path:   path,
+				Local:  fmt.Sprintf("%d", lEntry.GetSize()),
+				Remote: fmt.Sprintf("%d", rEntry.GetSize()),
+			})
+		} else if checksums && !lEntry.GetIsDir() && lEntry.GetCheckSum() != rEntry.GetCheckSum() {
+			diffs = append(diffs, Difference{
+				Kind:   DiffChecksum,
+				Path:   path,
+				Local:  checksumOrUnreadable(lEntry),
+				Remote: checksumOrUnreadable(rEntry),
+			})
+		}
+
+		if lEntry.GetMode() != rEntry.GetMode() {
+			diffs = append(diffs, Difference{
+				Kind:   DiffMode,
+				Path:   path,
+				Local:  fmt.Sprintf("%04o", lEntry.GetMode()),
+				Remote: fmt.Sprintf("%04o", rEntry.GetMode()),
+			})
+		}
+	}
+
+	return diffs
+}
+
+// entryType Describe what kind of path an entry is.
+func entryType(entry *TreeEntry) string {
+	if entry.GetIsDir() {
+		return "directory"
+	}
+
+	return "file"
+}
+
+// checksumOrUnreadable Checksum of an entry. Listing a tree leaves it empty
+// for files that couldn't be read.
+func checksumOrUnreadable(entry *TreeEntry) string {
+	if entry.GetCheckSum() == "" {
+		return "unreadable"
+	}
+
+	return entry.GetCheckSum()
+}
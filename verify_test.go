@@ -0,0 +1,97 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareEntries(t *testing.T) {
+	local := []*TreeEntry{
+		{Path: "d", IsDir: true, Mode: 0755},
+		{Path: "d/missing", Size: 1, Mode: 0644, CheckSum: "a"},
+		{Path: "rotted", Size: 1, Mode: 0644, CheckSum: "a"},
+		{Path: "shorter", Size: 2, Mode: 0600, CheckSum: "a"},
+		{Path: "type", Size: 1, Mode: 0644, CheckSum: "a"},
+		{Path: "unreadable", Size: 1, Mode: 0644, CheckSum: "a"},
+	}
+
+	remote := []*TreeEntry{
+		{Path: "d", IsDir: true, Mode: 0755},
+		{Path: "extra", IsDir: true, Mode: 0755},
+		{Path: "rotted", Size: 1, Mode: 0644, CheckSum: "b"},
+		{Path: "shorter", Size: 1, Mode: 0644, CheckSum: "a"},
+		{Path: "type", IsDir: true, Mode: 0755},
+		{Path: "unreadable", Size: 1, Mode: 0644},
+	}
+
+	want := []Difference{
+		{Kind: DiffMissing, Path: "d/missing", Local: "file"},
+		{Kind: DiffExtra, Path: "extra", Remote: "directory"},
+		{Kind: DiffChecksum, Path: "rotted", Local: "a", Remote: "b"},
+		{Kind: DiffSize, Path: "shorter", Local: "2", Remote: "1"},
+		{Kind: DiffMode, Path: "shorter", Local: "0600", Remote: "0644"},
+		{Kind: DiffType, Path: "type", Local: "file", Remote: "directory"},
+		{Kind: DiffChecksum, Path: "unreadable", Local: "a", Remote: "unreadable"},
+	}
+
+	if got := CompareEntries(local, remote, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("CompareEntries returned\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Without checksums only sizes, modes and types are compared.
+	var withoutChecksums []Difference
+	for _, diff := range want {
+		if diff.Kind != DiffChecksum {
+			withoutChecksums = append(withoutChecksums, diff)
+		}
+	}
+
+	if got := CompareEntries(local, remote, false); !reflect.DeepEqual(got, withoutChecksums) {
+		t.Errorf("CompareEntries without checksums returned\n%+v\nwant\n%+v", got, withoutChecksums)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	remote := testTree(t)
+	dir := testTree(t)
+
+	writeTestFile(t, filepath.Join(dir, "same"), "same")
+	writeTestFile(t, filepath.Join(dir, "rotted"), "abcd")
+	writeTestFile(t, filepath.Join(dir, "skip.tmp"), "excluded")
+
+	writeTestFile(t, filepath.Join(remote, "same"), "same")
+	writeTestFile(t, filepath.Join(remote, "rotted"), "abce")
+	writeTestFile(t, filepath.Join(remote, "gone"), "gone")
+
+	exclude, err := NewExcludeFilter([]string{"*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := connectTestReceiver(t, &testReceiver{root: remote})
+	sender.BasePath = dir
+
+	report, err := Verify(sender, exclude, true)
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+
+	if report.Files != 2 || report.Directories != 0 || report.Bytes != 8 {
+		t.Errorf("Verify counted %d files, %d directories and %d bytes, want 2, 0 and 8", report.Files, report.Directories, report.Bytes)
+	}
+
+	var out bytes.Buffer
+	report.Write(&out)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || lines[0] != "extra\tgone\t\tfile" || !strings.HasPrefix(lines[1], "checksum\trotted\t") {
+		t.Errorf("Verify reported:\n%s", out.String())
+	}
+}
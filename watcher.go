@@ -0,0 +1,85 @@
+/*
+Written by Ole Fredrik Skudsvik <ole.skudsvik@gmail.com> 2021
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// WatcherAuto Pick a watcher based on the filesystem we are watching.
+	// fanotify sees every change on the filesystem, so it is only picked for
+	// trees with more directories than inotify can watch.
+	WatcherAuto = "auto"
+
+	// WatcherInotify Watch using inotify.
+	WatcherInotify = "inotify"
+
+	// WatcherFanotify Watch the whole filesystem using fanotify.
+	WatcherFanotify = "fanotify"
+
+	// WatcherPoll Watch by periodically scanning the tree.
+	WatcherPoll = "poll"
+)
+
+// Watcher is implemented by the backends that monitor a directory for changes
+// and queue them on a TransferManager.
+type Watcher interface {
+	// Start watching.
+	Start() error
+
+	// Rescan Queue anything in the tree that isn't known to be in sync, used
+	// after the exclude filter has changed.
+	Rescan()
+
+	// Close stop watching.
+	Close() error
+}
+
+// NewWatcher Create a watcher of the given kind, watching basePath. When
+// events are lost the tree is compared against the remote, by checksum if
+// checksums is set.
+func NewWatcher(kind string, basePath string, transferManager *TransferManager, pollInterval time.Duration, checksums bool) (Watcher, error) {
+	switch kind {
+	case WatcherInotify:
+		return NewFileWatcher(basePath, transferManager, checksums), nil
+
+	case WatcherFanotify:
+		if !FanotifyAvailable() {
+			return nil, fmt.Errorf("fanotify is not available, it needs CAP_SYS_ADMIN and Linux 5.9 or newer")
+		}
+
+		return NewFanotifyWatcher(basePath, transferManager, checksums), nil
+
+	case WatcherPoll:
+		return NewPollWatcher(basePath, transferManager, pollInterval), nil
+
+	case WatcherAuto:
+		// inotify only sees changes made through the local kernel.
+		if fsType, remote := IsRemoteFilesystem(basePath); remote {
+			transferManager.Logger.Warn("inotify can't watch this filesystem reliably, falling back to polling",
+				Fields{"path": basePath, "fstype": fsType})
+			return NewPollWatcher(basePath, transferManager, pollInterval), nil
+		}
+
+		// inotify needs a watch per directory, one fanotify mark covers the
+		// whole tree.
+		if limit, ok := InotifyWatchLimit(); ok && FanotifyAvailable() && MoreDirectoriesThan(basePath, limit) {
+			transferManager.Logger.Info("Tree has more directories than the inotify watch limit, using fanotify",
+				Fields{"path": basePath, "limit": limit})
+			return NewFanotifyWatcher(basePath, transferManager, checksums), nil
+		}
+
+		if !InotifyAvailable() {
+			transferManager.Logger.Warn("inotify is not available, falling back to polling")
+			return NewPollWatcher(basePath, transferManager, pollInterval), nil
+		}
+
+		return NewFileWatcher(basePath, transferManager, checksums), nil
+	}
+
+	return nil, fmt.Errorf("Unknown watcher '%s', supported watchers are %s, %s, %s and %s", kind, WatcherAuto, WatcherInotify, WatcherFanotify, WatcherPoll)
+}